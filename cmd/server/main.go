@@ -2,16 +2,32 @@
 package main
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/joho/godotenv"
 	"github.com/minab/internship-backend/config"
 	_ "github.com/minab/internship-backend/docs"
 	"github.com/minab/internship-backend/internal/api"
+	"github.com/minab/internship-backend/internal/db"
+	"github.com/minab/internship-backend/internal/logging"
+	"github.com/minab/internship-backend/internal/metrics"
 	"github.com/minab/internship-backend/internal/middleware"
 	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/router"
+	"github.com/minab/internship-backend/internal/server"
 	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -24,39 +40,215 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey APIKeyAuth
+// @in header
+// @name X-API-Key
+
+const usage = `Usage:
+  server [-config file]               run the server
+  server [-config file] config print  print the effective configuration with secrets masked
+
+Flags:
+`
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, using environment variables")
+	configPath := flag.String("config", "", "path of the YAML config file (default $CONFIG_FILE)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
-	cfg := config.Load()
+	envErr := godotenv.Load()
+	cfg, cfgErr := config.Load(*configPath)
+
+	switch strings.Join(flag.Args(), " ") {
+	case "":
+	case "config print":
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if cfgErr != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", cfgErr)
+			os.Exit(1)
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if cfgErr != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", cfgErr)
+		os.Exit(1)
+	}
+
+	if err := logging.Setup(logging.Config(cfg.Log)); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found, using environment variables")
+	}
 
-	userRepo := repository.NewUserRepository(cfg.Database)
-	userService := service.NewUserService(userRepo)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config(cfg.Tracing))
+	if err != nil {
+		fatal("Invalid tracing configuration", err)
+	}
 
-	mux := http.NewServeMux()
+	if err := util.ConfigurePasswordHashing(util.PasswordHashing(cfg.Hashing)); err != nil {
+		fatal("Invalid password hashing configuration", err)
+	}
+	util.ConfigureEmail(util.EmailSettings(cfg.Email))
+	if err := util.ConfigureTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid trusted proxies", err)
+	}
+	jwtKey := []byte(cfg.JWT.Secret)
+	if len(jwtKey) == 0 {
+		// Only allowed in development: tokens stop working when the server restarts
+		slog.Warn("JWT_SECRET is not set, signing tokens with a random key")
+		jwtKey = make([]byte, 32)
+		if _, err := rand.Read(jwtKey); err != nil {
+			fatal("Failed to generate JWT key", err)
+		}
+	}
+	util.ConfigureJWT(jwtKey)
 
-	if cfg.AppEnv == "development" {
-		log.Println("Swagger UI available at /swagger/")
-		mux.Handle("/swagger/", httpSwagger.WrapHandler)
+	database, err := db.Connect(context.Background(), db.Config(cfg.Database))
+	if err != nil {
+		fatal("Failed to connect to the database", err)
 	}
 
-	passwordResetRepo := repository.NewPasswordResetRepository(cfg.Database)
-	passwordResetService := service.NewPasswordResetService(passwordResetRepo, userRepo)
+	txManager := repository.NewTxManager(database.Primary)
+	userRepo := repository.NewUserRepository(database.Primary, database.Reader())
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(database.Primary)
+	passwordService := service.NewPasswordService(service.PasswordPolicy(cfg.Password), userRepo, passwordHistoryRepo)
+	emailVerificationRepo := repository.NewEmailVerificationRepository(database.Primary)
+	emailVerificationService := service.NewEmailVerificationService(emailVerificationRepo, userRepo)
+	userService := service.NewUserService(txManager, userRepo, passwordService, emailVerificationService)
+	sessionRepo := repository.NewSessionRepository(database.Primary)
+	sessionService := service.NewSessionService(sessionRepo)
+	apiKeyRepo := repository.NewAPIKeyRepository(database.Primary)
+	apiKeyService := service.NewAPIKeyService(apiKeyRepo, userRepo)
+	auditRepo := repository.NewAuditRepository(database.Primary, database.Reader())
+	auditService := service.NewAuditService(auditRepo)
+	impersonationService := service.NewImpersonationService(userRepo, auditService)
+	idempotencyRepo := repository.NewIdempotencyRepository(database.Primary)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo)
 
-	// Register only public routes here (e.g., login, register)
-	api.RegisterPublicRoutes(mux, userService, passwordResetService)
+	r := router.New()
 
-	// Register protected routes on a separate mux
-	protectedMux := http.NewServeMux()
-	api.RegisterProtectedRoutes(protectedMux, userService)
+	if cfg.IsDevelopment() || cfg.Features.SwaggerUI {
+		slog.Info("Swagger UI available at /swagger/")
+		r.Handle(http.MethodGet, "/swagger/", httpSwagger.WrapHandler)
+	}
 
-	// Protect all /api/v1/ routes except login/register
-	mux.Handle("/api/v1/", middleware.JWTAuth(protectedMux))
+	passwordResetRepo := repository.NewPasswordResetRepository(database.Primary)
+	passwordResetService := service.NewPasswordResetService(txManager, passwordResetRepo, userRepo, sessionRepo, apiKeyRepo, emailVerificationRepo, passwordService)
 
-	log.Printf("Server running on port %s\n", cfg.Port)
-	if err := http.ListenAndServe(":"+cfg.Port, mux); err != nil {
-		log.Fatalf("Server error: %v", err)
+	var oidcProviders []*util.OIDCProvider
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders = append(oidcProviders, util.NewOIDCProvider(p.Name, p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURL, p.Scopes))
+	}
+	identityRepo := repository.NewIdentityRepository(database.Primary)
+	oidcService := service.NewOIDCService(oidcProviders, identityRepo, userRepo)
+
+	healthService := service.NewHealthService(repository.NewHealthRepository(database.Primary), cfg.Features.ReadinessCheckSMTP)
+	api.RegisterHealthRoutes(r, healthService)
+
+	if err := metrics.RegisterDB(database.Primary, "postgres"); err != nil {
+		fatal("Failed to register database metrics", err)
+	}
+	if database.Replica != nil {
+		if err := metrics.RegisterDB(database.Replica, "postgres_replica"); err != nil {
+			fatal("Failed to register database metrics", err)
+		}
 	}
+
+	idempotent := router.Use("idempotency", middleware.Idempotency(idempotencyService))
+	v1 := r.Group("/api/v1")
+
+	// Public routes are limited per client IP
+	public := v1.Group("",
+		router.Use("ratelimit:ip", middleware.RateLimit(middleware.NewRateLimiter(cfg.RateLimit.PublicPerMinute, cfg.RateLimit.PublicBurst, middleware.ClientIPKey))),
+		idempotent,
+	)
+	api.RegisterPublicRoutes(public, userService, sessionService, passwordResetService, oidcService, emailVerificationService)
+
+	// Protected routes are limited per user; idempotency keys are scoped to the authenticated user
+	protected := v1.Group("",
+		router.Use("auth", middleware.Authenticate(sessionService, apiKeyService)),
+		router.Use("audit-impersonation", middleware.AuditImpersonation(auditService)),
+		router.Use("ratelimit:user", middleware.RateLimit(middleware.NewRateLimiter(cfg.RateLimit.APIPerMinute, cfg.RateLimit.APIBurst, middleware.UserKey))),
+		idempotent,
+	)
+	api.RegisterProtectedRoutes(protected, userService, sessionService, apiKeyService, impersonationService, auditService)
+
+	for _, route := range r.Routes() {
+		slog.Info("Route registered", "method", route.Method, "path", route.Path, "middleware", route.Middleware)
+	}
+
+	// Preflight requests match no route, so CORS wraps the router
+	cors := middleware.CORS(middleware.CORSConfig(cfg.CORS))
+
+	// Tag every request with an ID, IP address and user agent for the audit log and logs
+	// Metrics are served on their own listener, not next to the public API
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("GET /metrics", metrics.Handler())
+	srv, err := server.New(server.Config(cfg.Server), middleware.RequestMeta(middleware.Tracing(middleware.AccessLog(middleware.Metrics(cors(r))))), metricsMux)
+	if err != nil {
+		fatal("Invalid server configuration", err)
+	}
+
+	// SIGHUP reloads the TLS certificate
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := srv.ReloadCertificate(); err != nil {
+				slog.Error("Failed to reload TLS certificate", "error", err)
+			} else {
+				slog.Info("Reloaded TLS certificate")
+			}
+		}
+	}()
+
+	// Background workers stop after the server has drained, before the database is closed
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	janitor := service.NewJanitor(cfg.JanitorInterval, idempotencyRepo, identityRepo, passwordResetRepo, emailVerificationRepo)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		janitor.Run(workersCtx)
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		// A second signal kills the process without waiting for the shutdown
+		<-ctx.Done()
+		stop()
+	}()
+	runErr := srv.Run(ctx)
+
+	stopWorkers()
+	workers.Wait()
+	if err := database.Close(); err != nil {
+		slog.Error("Failed to close database", "error", err)
+	}
+	// Flush the spans of the last requests
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	cancelFlush()
+	if runErr != nil {
+		fatal("Server error", runErr)
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -1,47 +1,219 @@
+// Package config loads the typed configuration of the server. Defaults are overridden
+// by an optional YAML file, which is overridden by environment variables; the result
+// is validated as a whole so every problem is reported at once.
 package config
 
 import (
-	"database/sql"
-	"log"
-	"os"
-
-	_ "github.com/lib/pq" // or your DB driver
+	"time"
 )
 
 type Config struct {
-	Port     string
-	Database *sql.DB
-	AppEnv   string
+	// AppEnv is the deployment environment, e.g. development or production.
+	AppEnv   string         `yaml:"app_env" env:"APP_ENV"`
+	Server   ServerConfig   `yaml:"server"`
+	Log      LogConfig      `yaml:"log"`
+	Database DatabaseConfig `yaml:"database"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Email    EmailConfig    `yaml:"email"`
+	CORS     CORSConfig     `yaml:"cors"`
+	// TrustedProxies are the reverse proxies, as CIDR ranges or addresses, whose
+	// X-Forwarded-For and X-Real-IP headers name the client. Empty trusts none.
+	TrustedProxies []string              `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	OIDCProviders  []OIDCProviderConfig  `yaml:"oidc_providers" env:"-"`
+	Password       PasswordPolicyConfig  `yaml:"password"`
+	Hashing        PasswordHashingConfig `yaml:"hashing"`
+	RateLimit      RateLimitConfig       `yaml:"rate_limit"`
+	Tracing        TracingConfig         `yaml:"tracing"`
+	Features       FeatureConfig         `yaml:"features"`
+	// JanitorInterval is how often expired tokens and idempotency keys are deleted.
+	JanitorInterval time.Duration `yaml:"janitor_interval" env:"JANITOR_INTERVAL"`
 }
 
-func Load() *Config {
-	port := getEnv("PORT", "8080")
-	dbURL := getEnv("DATABASE_URL", "")
-	appEnv := getEnv("APP_ENV", "development")
+// LogConfig selects the level (debug, info, warn, error) and format (json, text) of logs.
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
 
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable required")
-	}
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		log.Fatalf("Failed to connect to DB: %v", err)
-	}
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Failed to ping DB: %v", err)
-	}
+// TracingConfig selects the span exporter (none, otlp or stdout) and the fraction of
+// traces that are sampled. OTLP is configured with the standard OTEL_EXPORTER_OTLP_*
+// variables.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// ServerConfig holds the listen port, timeouts and TLS files of the HTTP server.
+type ServerConfig struct {
+	Port              string        `yaml:"port" env:"PORT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set. The files are reloaded
+	// on SIGHUP and when they change.
+	TLSCertFile string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	// MetricsAddr is the host:port of a separate plain HTTP listener that serves
+	// /metrics, so that it is not exposed with the API. Empty disables it.
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR"`
+}
+
+// DatabaseConfig holds the PostgreSQL connection strings and connection pool limits.
+type DatabaseConfig struct {
+	URL string `yaml:"url" env:"DATABASE_URL" secret:"url"`
+	// ReplicaURL is an optional read replica that serves read-only queries which
+	// tolerate replication lag, such as listing users.
+	ReplicaURL   string `yaml:"replica_url" env:"DATABASE_REPLICA_URL" secret:"url"`
+	MaxOpenConns int    `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns int    `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	// ConnMaxLifetime and ConnMaxIdleTime close connections that are older or have been
+	// idle for longer; 0 keeps them forever.
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// ConnectTimeout is how long startup keeps retrying to reach the database.
+	ConnectTimeout time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+}
+
+// JWTConfig holds the key that signs login tokens.
+type JWTConfig struct {
+	// Secret is the HMAC key of issued tokens. It is required outside development,
+	// where a random key is generated when it is not set.
+	Secret string `yaml:"secret" env:"JWT_SECRET" secret:"true"`
+}
+
+// EmailConfig holds the mail server used to send emails and the frontend their links
+// point to.
+type EmailConfig struct {
+	Host     string `yaml:"host" env:"EMAIL_HOST"`
+	Port     int    `yaml:"port" env:"EMAIL_PORT"`
+	Username string `yaml:"username" env:"EMAIL_USER"`
+	Password string `yaml:"password" env:"EMAIL_PASS" secret:"true"`
+	From     string `yaml:"from" env:"EMAIL_FROM"`
+	// FrontendURL is the base URL of the links in emails, e.g. https://app.example.com.
+	FrontendURL string `yaml:"frontend_url" env:"FRONTEND_URL"`
+}
 
+// CORSConfig lists the browser origins allowed to call the API. No origins disables CORS.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// FeatureConfig switches optional behavior on or off.
+type FeatureConfig struct {
+	// SwaggerUI serves the API docs at /swagger/; they are always served in development.
+	SwaggerUI bool `yaml:"swagger_ui" env:"SWAGGER_UI"`
+	// ReadinessCheckSMTP makes /readyz also require the mail server to be reachable.
+	ReadinessCheckSMTP bool `yaml:"readiness_check_smtp" env:"READINESS_CHECK_SMTP"`
+}
+
+// RateLimitConfig holds the per-client request limits of the route groups. A limit of 0
+// disables it.
+type RateLimitConfig struct {
+	// PublicPerMinute and PublicBurst limit unauthenticated routes per client IP.
+	PublicPerMinute int `yaml:"public_per_minute" env:"RATE_LIMIT_PUBLIC_PER_MINUTE"`
+	PublicBurst     int `yaml:"public_burst" env:"RATE_LIMIT_PUBLIC_BURST"`
+	// APIPerMinute and APIBurst limit authenticated routes per user.
+	APIPerMinute int `yaml:"api_per_minute" env:"RATE_LIMIT_API_PER_MINUTE"`
+	APIBurst     int `yaml:"api_burst" env:"RATE_LIMIT_API_BURST"`
+}
+
+// PasswordHashingConfig selects the algorithm and cost of new password hashes.
+type PasswordHashingConfig struct {
+	Algorithm         string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM"`
+	BcryptCost        int    `yaml:"bcrypt_cost" env:"BCRYPT_COST"`
+	Argon2Memory      uint32 `yaml:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env:"ARGON2_ITERATIONS"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"ARGON2_PARALLELISM"`
+}
+
+// PasswordPolicyConfig holds the rules enforced on every new password.
+type PasswordPolicyConfig struct {
+	MinLength     int  `yaml:"min_length" env:"PASSWORD_MIN_LENGTH"`
+	MaxLength     int  `yaml:"max_length" env:"PASSWORD_MAX_LENGTH"`
+	RequireUpper  bool `yaml:"require_upper" env:"PASSWORD_REQUIRE_UPPER"`
+	RequireLower  bool `yaml:"require_lower" env:"PASSWORD_REQUIRE_LOWER"`
+	RequireDigit  bool `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT"`
+	RequireSymbol bool `yaml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL"`
+	HistorySize   int  `yaml:"history_size" env:"PASSWORD_HISTORY_SIZE"`
+	CheckBreached bool `yaml:"check_breached" env:"PASSWORD_CHECK_BREACHED"`
+}
+
+// OIDCProviderConfig describes one OpenID Connect provider for social login.
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// Default returns the configuration used for every setting that is not set in the
+// config file or the environment.
+func Default() *Config {
 	return &Config{
-		Port:     port,
-		Database: db,
-		AppEnv:   appEnv,
+		AppEnv: "development",
+		Server: ServerConfig{
+			Port:              "8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			MetricsAddr:       "127.0.0.1:9090",
+		},
+		Log: LogConfig{Level: "info", Format: "json"},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  30 * time.Second,
+		},
+		Email: EmailConfig{Port: 587},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "X-API-Key", "X-Request-ID"},
+			ExposedHeaders: []string{"ETag", "Idempotent-Replayed", "Retry-After", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		Password: PasswordPolicyConfig{
+			MinLength:     10,
+			MaxLength:     72,
+			RequireUpper:  true,
+			RequireLower:  true,
+			RequireDigit:  true,
+			RequireSymbol: false,
+			HistorySize:   5,
+			CheckBreached: true,
+		},
+		Hashing: PasswordHashingConfig{
+			Algorithm:         "argon2id",
+			BcryptCost:        12,
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+		},
+		RateLimit: RateLimitConfig{
+			PublicPerMinute: 30,
+			PublicBurst:     10,
+			APIPerMinute:    600,
+			APIBurst:        100,
+		},
+		Tracing:         TracingConfig{Exporter: "none", SampleRatio: 1},
+		JanitorInterval: time.Hour,
 	}
 }
 
-func getEnv(key, fallback string) string {
-	if value := os.Getenv(key); value != "" {
-		log.Printf("Loaded environment variable %s=%s", key, value)
-		return value
-	}
-	log.Printf("Environment variable %s not set, using fallback=%s", key, fallback)
-	return fallback
+// IsDevelopment reports whether the server runs in the development environment.
+func (c *Config) IsDevelopment() bool {
+	return c.AppEnv == "development"
 }
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// minJWTSecretLength is the shortest accepted JWT_SECRET, in bytes.
+const minJWTSecretLength = 32
+
+// validate returns every problem with the configuration, each naming the setting it
+// concerns.
+func (c *Config) validate() []error {
+	var errs []error
+	fail := func(setting, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+	positive := func(setting string, d time.Duration) {
+		if d <= 0 {
+			fail(setting, "must be a positive duration such as 30s")
+		}
+	}
+	oneOf := func(setting, value string, allowed ...string) {
+		if !slices.Contains(allowed, strings.ToLower(value)) {
+			fail(setting, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+		}
+	}
+
+	if c.AppEnv == "" {
+		fail("app_env", "is required")
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		fail("server.port", "must be a port number, got %q", c.Server.Port)
+	}
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		fail("server.tls_cert_file", "must be set together with server.tls_key_file")
+	}
+	if c.Server.MetricsAddr != "" {
+		_, port, err := net.SplitHostPort(c.Server.MetricsAddr)
+		if n, perr := strconv.Atoi(port); err != nil || perr != nil || n < 1 || n > 65535 {
+			fail("server.metrics_addr", "must be host:port, got %q", c.Server.MetricsAddr)
+		} else if port == c.Server.Port {
+			fail("server.metrics_addr", "must not use the API port %s", c.Server.Port)
+		}
+	}
+
+	oneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")
+	oneOf("log.format", c.Log.Format, "json", "text")
+
+	if c.Database.URL == "" {
+		fail("database.url", "is required")
+	}
+	if c.Database.MaxOpenConns < 0 {
+		fail("database.max_open_conns", "must not be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		fail("database.max_idle_conns", "must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		fail("database.max_idle_conns", "must not exceed database.max_open_conns")
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		fail("database.conn_max_lifetime", "must not be negative")
+	}
+	if c.Database.ConnMaxIdleTime < 0 {
+		fail("database.conn_max_idle_time", "must not be negative")
+	}
+	positive("database.connect_timeout", c.Database.ConnectTimeout)
+
+	switch {
+	case c.JWT.Secret == "" && !c.IsDevelopment():
+		fail("jwt.secret", "is required outside development")
+	case c.JWT.Secret != "" && len(c.JWT.Secret) < minJWTSecretLength:
+		fail("jwt.secret", "must be at least %d bytes long", minJWTSecretLength)
+	}
+
+	if c.Email.Port < 1 || c.Email.Port > 65535 {
+		fail("email.port", "must be a port number, got %d", c.Email.Port)
+	}
+	if c.Email.Host != "" && c.Email.From == "" {
+		fail("email.from", "is required when email.host is set")
+	}
+	if c.Email.FrontendURL != "" && !isAbsoluteURL(c.Email.FrontendURL) {
+		fail("email.frontend_url", "must be an absolute URL such as https://app.example.com, got %q", c.Email.FrontendURL)
+	}
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				fail("cors.allowed_origins", "must list the origins explicitly when cors.allow_credentials is set")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || !isAbsoluteURL(origin) || (u.Path != "" && u.Path != "/") {
+			fail("cors.allowed_origins", "must be * or origins such as https://app.example.com, got %q", origin)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		fail("cors.max_age", "must not be negative")
+	}
+
+	if _, err := util.ParseTrustedProxies(c.TrustedProxies); err != nil {
+		fail("trusted_proxies", "%v", err)
+	}
+
+	names := map[string]bool{}
+	for i, p := range c.OIDCProviders {
+		setting := fmt.Sprintf("oidc_providers[%d]", i)
+		if p.Name == "" {
+			fail(setting+".name", "is required")
+		} else if names[p.Name] {
+			fail(setting+".name", "duplicate provider %q", p.Name)
+		}
+		names[p.Name] = true
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			fail(setting, "provider %q requires issuer, client_id and redirect_url", p.Name)
+		}
+	}
+
+	if c.Password.MinLength < 1 {
+		fail("password.min_length", "must be at least 1")
+	}
+	if c.Password.MaxLength != 0 && c.Password.MaxLength < c.Password.MinLength {
+		fail("password.max_length", "must be 0 (no limit) or at least password.min_length")
+	}
+	if c.Password.HistorySize < 0 {
+		fail("password.history_size", "must not be negative")
+	}
+
+	oneOf("hashing.algorithm", c.Hashing.Algorithm, "argon2id", "bcrypt")
+
+	if c.RateLimit.PublicPerMinute < 0 || c.RateLimit.PublicBurst < 0 || c.RateLimit.APIPerMinute < 0 || c.RateLimit.APIBurst < 0 {
+		fail("rate_limit", "limits must not be negative")
+	}
+
+	oneOf("tracing.exporter", c.Tracing.Exporter, "none", "otlp", "stdout")
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	positive("janitor_interval", c.JanitorInterval)
+	return errs
+}
+
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
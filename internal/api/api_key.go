@@ -0,0 +1,224 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+type APIKeyHandler struct {
+	service     *service.APIKeyService
+	userService *service.UserService
+}
+
+// CreateAPIKeyResponse carries the plaintext key, which is only ever shown here.
+type CreateAPIKeyResponse struct {
+	Key    string        `json:"key"`
+	APIKey *model.APIKey `json:"api_key"`
+}
+
+func NewAPIKeyHandler(service *service.APIKeyService, userService *service.UserService) *APIKeyHandler {
+	return &APIKeyHandler{service: service, userService: userService}
+}
+
+// @Summary List my API keys
+// @Description List the active API keys of the authenticated user
+// @Tags api-keys
+// @Produce  json
+// @Success 200 {array} model.APIKey
+// @Failure 500 {object} util.Problem "Failed to list API keys"
+// @Router /me/api-keys [get]
+// @Security BearerAuth
+func (h *APIKeyHandler) ListMyKeys(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	h.writeKeys(w, r, func() ([]*model.APIKey, error) {
+		return h.service.ListKeys(r.Context(), claims.UserID)
+	})
+}
+
+// @Summary Create an API key
+// @Description Create a named, scoped and expiring API key for the authenticated user. The key is only returned once.
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Param key body model.CreateAPIKeyRequest true "Key name, scopes and lifetime"
+// @Param Idempotency-Key header string false "Only guards against concurrent duplicates: responses carrying credentials are never stored or replayed"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} util.Problem "Invalid request"
+// @Failure 500 {object} util.Problem "Failed to create API key"
+// @Router /me/api-keys [post]
+// @Security BearerAuth
+func (h *APIKeyHandler) CreateMyKey(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	h.createKey(w, r, func(req *model.CreateAPIKeyRequest) (string, *model.APIKey, error) {
+		return h.service.CreateKey(r.Context(), claims.UserID, req)
+	})
+}
+
+// @Summary Revoke an API key
+// @Description Revoke one of the authenticated user's API keys
+// @Tags api-keys
+// @Produce  json
+// @Param id path string true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} util.Problem "Invalid API key ID"
+// @Failure 404 {object} util.Problem "API key not found"
+// @Router /me/api-keys/{id} [delete]
+// @Security BearerAuth
+func (h *APIKeyHandler) RevokeMyKey(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	h.revokeKey(w, r, claims.UserID, id)
+}
+
+// @Summary Create a service account
+// @Description Admin only: create a user that can only authenticate with API keys
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Param account body model.CreateServiceAccountRequest true "Service account data"
+// @Param Idempotency-Key header string false "Makes retries safe: the first response for this key is replayed for 24h"
+// @Success 201 {object} UserResponse
+// @Failure 400 {object} util.Problem "Invalid request body"
+// @Failure 403 {object} util.Problem "Forbidden"
+// @Failure 500 {object} util.Problem "Failed to create service account"
+// @Router /service-accounts [post]
+// @Security BearerAuth
+func (h *APIKeyHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	var req model.CreateServiceAccountRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	account, err := h.userService.CreateServiceAccount(r.Context(), &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := newUserResponse(account)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary List service account keys
+// @Description Admin only: list the active API keys of a service account
+// @Tags api-keys
+// @Produce  json
+// @Param id path string true "Service account user ID"
+// @Success 200 {array} model.APIKey
+// @Failure 400 {object} util.Problem "Invalid service account ID"
+// @Failure 404 {object} util.Problem "Service account not found"
+// @Router /service-accounts/{id}/keys [get]
+// @Security BearerAuth
+func (h *APIKeyHandler) ListServiceAccountKeys(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	h.writeKeys(w, r, func() ([]*model.APIKey, error) {
+		return h.service.ListServiceAccountKeys(r.Context(), accountID)
+	})
+}
+
+// @Summary Create a service account key
+// @Description Admin only: create an API key for a service account. The key is only returned once.
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Param id path string true "Service account user ID"
+// @Param key body model.CreateAPIKeyRequest true "Key name, scopes and lifetime"
+// @Param Idempotency-Key header string false "Only guards against concurrent duplicates: responses carrying credentials are never stored or replayed"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} util.Problem "Invalid request"
+// @Failure 404 {object} util.Problem "Service account not found"
+// @Router /service-accounts/{id}/keys [post]
+// @Security BearerAuth
+func (h *APIKeyHandler) CreateServiceAccountKey(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	h.createKey(w, r, func(req *model.CreateAPIKeyRequest) (string, *model.APIKey, error) {
+		return h.service.CreateServiceAccountKey(r.Context(), accountID, req)
+	})
+}
+
+// @Summary Revoke a service account key
+// @Description Admin only: revoke an API key of a service account
+// @Tags api-keys
+// @Produce  json
+// @Param id path string true "Service account user ID"
+// @Param keyID path string true "API key ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} util.Problem "Invalid ID"
+// @Failure 404 {object} util.Problem "API key not found"
+// @Router /service-accounts/{id}/keys/{keyID} [delete]
+// @Security BearerAuth
+func (h *APIKeyHandler) RevokeServiceAccountKey(w http.ResponseWriter, r *http.Request) {
+	accountID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	keyID, ok := pathID(w, r, "keyID")
+	if !ok {
+		return
+	}
+	h.revokeKey(w, r, accountID, keyID)
+}
+
+func (h *APIKeyHandler) writeKeys(w http.ResponseWriter, r *http.Request, list func() ([]*model.APIKey, error)) {
+	keys, err := list()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if keys == nil {
+		keys = []*model.APIKey{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *APIKeyHandler) createKey(w http.ResponseWriter, r *http.Request, create func(*model.CreateAPIKeyRequest) (string, *model.APIKey, error)) {
+	var req model.CreateAPIKeyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	plaintext, key, err := create(&req)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	// The secret is shown once: neither caches nor idempotent replays may keep it
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: plaintext, APIKey: key})
+}
+
+func (h *APIKeyHandler) revokeKey(w http.ResponseWriter, r *http.Request, userID, keyID string) {
+	if err := h.service.RevokeKey(r.Context(), userID, keyID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
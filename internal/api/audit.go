@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/service"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// @Summary List audit events
+// @Description Admin only: query the audit log, newest first
+// @Tags audit
+// @Produce  json
+// @Param actor_id query string false "User who made the change"
+// @Param impersonator_id query string false "Admin impersonating the actor"
+// @Param action query string false "Action, e.g. user.update"
+// @Param target_type query string false "Type of the changed entity, e.g. user"
+// @Param target_id query string false "ID of the changed entity"
+// @Param request_id query string false "X-Request-ID of the request that made the change"
+// @Param from query string false "Earliest time (RFC 3339, inclusive)"
+// @Param to query string false "Latest time (RFC 3339, exclusive)"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of events to skip"
+// @Success 200 {array} model.AuditEvent
+// @Failure 400 {object} util.Problem "Invalid filter"
+// @Failure 403 {object} util.Problem "Forbidden"
+// @Failure 500 {object} util.Problem "Failed to list audit events"
+// @Router /audit-events [get]
+// @Security BearerAuth
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := &model.AuditFilter{
+		ActorID:        q.Get("actor_id"),
+		ImpersonatorID: q.Get("impersonator_id"),
+		Action:         q.Get("action"),
+		TargetType:     q.Get("target_type"),
+		TargetID:       q.Get("target_id"),
+		RequestID:      q.Get("request_id"),
+		Limit:          defaultAuditPageSize,
+	}
+	var err error
+	if filter.From, err = parseTimeParam(q.Get("from")); err != nil {
+		badRequest(w, r, "invalid_from", "Invalid from time")
+		return
+	}
+	if filter.To, err = parseTimeParam(q.Get("to")); err != nil {
+		badRequest(w, r, "invalid_to", "Invalid to time")
+		return
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 || filter.Limit > maxAuditPageSize {
+			badRequest(w, r, "invalid_limit", "Invalid limit")
+			return
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if filter.Offset, err = strconv.Atoi(v); err != nil || filter.Offset < 0 {
+			badRequest(w, r, "invalid_offset", "Invalid offset")
+			return
+		}
+	}
+
+	events, err := h.service.ListEvents(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if events == nil {
+		events = []*model.AuditEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// @Summary Verify the audit log
+// @Description Admin only: recompute the hash chain of the audit log and report the first event that was altered, removed or reordered
+// @Tags audit
+// @Produce  json
+// @Success 200 {object} model.AuditChainReport
+// @Failure 403 {object} util.Problem "Forbidden"
+// @Failure 500 {object} util.Problem "Failed to verify audit log"
+// @Router /audit-events/verify [get]
+// @Security BearerAuth
+func (h *AuditHandler) VerifyChain(w http.ResponseWriter, r *http.Request) {
+	report, err := h.service.VerifyChain(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func parseTimeParam(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
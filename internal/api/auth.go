@@ -9,43 +9,50 @@ import (
 )
 
 type AuthHandler struct {
-	UserService *service.UserService
+	UserService    *service.UserService
+	SessionService *service.SessionService
 }
 
-func NewAuthHandler(us *service.UserService) *AuthHandler {
-	return &AuthHandler{UserService: us}
+func NewAuthHandler(us *service.UserService, ss *service.SessionService) *AuthHandler {
+	return &AuthHandler{UserService: us, SessionService: ss}
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 // @Summary Login
-// @Description Authenticate user and return JWT token
+// @Description Authenticate user, start a session and return a JWT token bound to it
 // @Tags auth
 // @Accept  json
 // @Produce  json
 // @Param credentials body LoginRequest true "Login credentials"
+// @Param Idempotency-Key header string false "Only guards against concurrent duplicates: responses carrying credentials are never stored or replayed"
 // @Success 200 {object} map[string]string
-// @Failure 400 {string} string "Invalid request"
-// @Failure 401 {string} string "Invalid credentials"
+// @Failure 400 {object} util.Problem "Invalid request"
+// @Failure 401 {object} util.Problem "Invalid credentials"
 // @Router /login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
-	user, err := h.UserService.GetByEmail(r.Context(), req.Email)
-	if err != nil || !util.CheckPasswordHash(req.Password, user.Password) {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	user, err := h.UserService.Authenticate(r.Context(), req.Email, req.Password)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	session, err := h.SessionService.StartSession(r.Context(), user.ID, r.UserAgent(), util.ClientIP(r))
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-	token, err := util.GenerateJWT(user.ID, user.Email, user.Role)
+	token, err := util.GenerateJWT(user.ID, user.Email, user.Role, session.ID)
 	if err != nil {
-		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	w.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(w).Encode(map[string]string{"token": token})
 }
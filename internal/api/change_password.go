@@ -1,12 +1,9 @@
 package api
 
 import (
-	"bytes"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
-	"os"
-	"text/template"
 
 	"github.com/minab/internship-backend/internal/service"
 	"github.com/minab/internship-backend/internal/util"
@@ -16,6 +13,15 @@ type PasswordResetHandler struct {
 	service *service.PasswordResetService
 }
 
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
 func NewPasswordResetHandler(service *service.PasswordResetService) *PasswordResetHandler {
 	return &PasswordResetHandler{service: service}
 }
@@ -25,44 +31,34 @@ func NewPasswordResetHandler(service *service.PasswordResetService) *PasswordRes
 // @Tags password
 // @Accept  json
 // @Produce  json
-// @Param email body map[string]string true "User email"
+// @Param email body ForgotPasswordRequest true "User email"
+// @Param Idempotency-Key header string false "Makes retries safe: the first response for this key is replayed for 24h"
 // @Success 200 {object} map[string]string
-// @Failure 400 {string} string "Invalid request"
-// @Failure 404 {string} string "User not found"
+// @Failure 400 {object} util.Problem "Invalid request"
+// @Failure 404 {object} util.Problem "User not found"
 // @Router /forgot-password [post]
 func (h *PasswordResetHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Email string `json:"email"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	var req ForgotPasswordRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	token, err := h.service.GenerateToken(r.Context(), req.Email)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
 
-	// Build the reset link
-	resetLink := os.Getenv("FRONTEND_URL") + "/reset-password?token=" + token
-
-	// Load and render the HTML template
-	tmpl, err := template.ParseFiles("internal/templates/reset_password.html")
+	body, err := util.RenderEmailTemplate("reset_password.html", map[string]string{
+		"ResetLink": util.FrontendLink("/reset-password?token=" + token),
+	})
 	if err != nil {
-		http.Error(w, "Failed to load email template", http.StatusInternalServerError)
-		return
-	}
-	var bodyBuf bytes.Buffer
-	if err := tmpl.Execute(&bodyBuf, map[string]string{"ResetLink": resetLink}); err != nil {
-		http.Error(w, "Failed to render email template", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// Send the email
-	if err := util.SendEmail(req.Email, "Reset Your Password", bodyBuf.String()); err != nil {
-		log.Printf("Failed to send email to %s: %v", req.Email, err)
-		http.Error(w, "Failed to send email", http.StatusInternalServerError)
+	if err := util.SendEmail(r.Context(), req.Email, "Reset Your Password", body); err != nil {
+		writeError(w, r, fmt.Errorf("sending reset email to %s: %w", req.Email, err))
 		return
 	}
 
@@ -71,25 +67,22 @@ func (h *PasswordResetHandler) ForgotPassword(w http.ResponseWriter, r *http.Req
 }
 
 // @Summary Reset password
-// @Description Reset user password using token
+// @Description Set a new password with the token from a reset email. The token can be used once. On success every session and API key of the user is revoked, their other reset tokens and pending email change are cancelled, and a confirmation is emailed to them.
 // @Tags password
 // @Accept  json
 // @Produce  json
-// @Param reset body map[string]string true "Token and new password"
+// @Param reset body ResetPasswordRequest true "Token and new password"
+// @Param Idempotency-Key header string false "Makes retries safe: the first response for this key is replayed for 24h"
 // @Success 200 {object} map[string]string
-// @Failure 400 {string} string "Invalid request or expired token"
+// @Failure 400 {object} util.Problem "Invalid request, unknown or used token (invalid_reset_token), expired token (reset_token_expired) or password rejected by policy"
 // @Router /reset-password [post]
 func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Token       string `json:"token"`
-		NewPassword string `json:"new_password"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+	var req ResetPasswordRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	if err := h.service.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
-		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
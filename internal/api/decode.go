@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// maxBodyBytes caps the size of JSON request bodies.
+const maxBodyBytes = 1 << 20
+
+// decodeJSON decodes the request body into dst and runs the validate tags of dst.
+// Unknown fields, trailing data and bodies over maxBodyBytes are rejected. On failure
+// it writes a problem response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	return decodeStrict(w, r, r.Body, dst)
+}
+
+// decodeMergePatch applies the request body, an RFC 7396 JSON Merge Patch, to the JSON
+// representation of current and decodes and validates the result into dst like decodeJSON.
+func decodeMergePatch(w http.ResponseWriter, r *http.Request, current, dst any) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		util.HTTPError(w, r, http.StatusUnsupportedMediaType, "unsupported_media_type", "PATCH requests must be sent as application/merge-patch+json")
+		return false
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeDecodeError(w, r, err)
+		return false
+	}
+	base, err := json.Marshal(current)
+	if err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	merged, err := util.MergePatch(base, patch)
+	if err != nil {
+		badRequest(w, r, "invalid_body", "Request body must be a JSON object")
+		return false
+	}
+	return decodeStrict(w, r, bytes.NewReader(merged), dst)
+}
+
+func decodeStrict(w http.ResponseWriter, r *http.Request, body io.Reader, dst any) bool {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		writeDecodeError(w, r, err)
+		return false
+	}
+	if dec.Decode(&struct{}{}) != io.EOF {
+		badRequest(w, r, "invalid_body", "Request body must contain a single JSON value")
+		return false
+	}
+	if fields := util.ValidateStruct(dst); fields != nil {
+		writeValidationError(w, r, fields)
+		return false
+	}
+	return true
+}
+
+func writeDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var (
+		maxErr    *http.MaxBytesError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &maxErr):
+		util.HTTPError(w, r, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("Request body must not exceed %d bytes", maxErr.Limit))
+	case errors.Is(err, io.EOF):
+		badRequest(w, r, "invalid_body", "Request body is empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		badRequest(w, r, "invalid_body", "Request body is not valid JSON")
+	case errors.As(err, &typeErr):
+		writeValidationError(w, r, []model.FieldError{{Field: typeErr.Field, Code: "type", Message: "must be a " + jsonTypeName(typeErr.Type.Kind().String())}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		writeValidationError(w, r, []model.FieldError{{Field: field, Code: "unknown_field", Message: "is not a known field"}})
+	default:
+		badRequest(w, r, "invalid_body", "Invalid request body")
+	}
+}
+
+func writeValidationError(w http.ResponseWriter, r *http.Request, fields []model.FieldError) {
+	util.WriteProblem(w, r, &util.Problem{
+		Status: http.StatusBadRequest,
+		Code:   "validation_failed",
+		Detail: "The request body failed validation",
+		Errors: fields,
+	})
+}
+
+// jsonTypeName names a Go kind the way a JSON client would think of it.
+func jsonTypeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "map", kind == "struct":
+		return "object"
+	case kind == "bool":
+		return "boolean"
+	default:
+		return kind
+	}
+}
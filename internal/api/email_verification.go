@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/service"
+)
+
+type EmailVerificationHandler struct {
+	service *service.EmailVerificationService
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+func NewEmailVerificationHandler(service *service.EmailVerificationService) *EmailVerificationHandler {
+	return &EmailVerificationHandler{service: service}
+}
+
+// @Summary Confirm a new email address
+// @Description Apply a pending email change using the token from the verification link
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param verification body VerifyEmailRequest true "Verification token"
+// @Param Idempotency-Key header string false "Makes retries safe: the first response for this key is replayed for 24h"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} util.Problem "Invalid or expired verification token"
+// @Failure 409 {object} util.Problem "Email already in use"
+// @Router /verify-email [post]
+func (h *EmailVerificationHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := h.service.Confirm(r.Context(), req.Token); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email updated"})
+}
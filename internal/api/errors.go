@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// kindStatus maps service error kinds to HTTP statuses.
+var kindStatus = map[service.ErrorKind]int{
+	service.KindValidation:         http.StatusBadRequest,
+	service.KindUnauthorized:       http.StatusUnauthorized,
+	service.KindForbidden:          http.StatusForbidden,
+	service.KindNotFound:           http.StatusNotFound,
+	service.KindConflict:           http.StatusConflict,
+	service.KindPreconditionFailed: http.StatusPreconditionFailed,
+	service.KindUnavailable:        http.StatusBadGateway,
+}
+
+// writeError responds with the problem details for err. Service errors are mapped by
+// kind; anything else is logged and reported as a 500 without revealing the cause.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var svcErr *service.Error
+	if !errors.As(err, &svcErr) {
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		util.HTTPError(w, r, http.StatusInternalServerError, "internal_error", "An unexpected error occurred")
+		return
+	}
+	status, ok := kindStatus[svcErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "Request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+	util.WriteProblem(w, r, &util.Problem{
+		Status: status,
+		Code:   svcErr.Code,
+		Detail: svcErr.Message,
+		Errors: svcErr.Fields,
+	})
+}
+
+func badRequest(w http.ResponseWriter, r *http.Request, code, detail string) {
+	util.HTTPError(w, r, http.StatusBadRequest, code, detail)
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	util.HTTPError(w, r, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// etag returns the strong entity tag of an entity at the given version.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseETag returns the version in a strong entity tag created by etag.
+func parseETag(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// requireIfMatch returns the version a conditional update expects from its If-Match header,
+// or repository.AnyVersion for "*". Requests without the header are rejected with 428 so
+// clients cannot overwrite changes they have not seen. On failure it writes a problem
+// response and returns false.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		util.HTTPError(w, r, http.StatusPreconditionRequired, "precondition_required", "Updates require an If-Match header with the ETag of the resource")
+		return 0, false
+	}
+	if header == "*" {
+		return repository.AnyVersion, true
+	}
+	version, ok := parseETag(header)
+	if !ok {
+		badRequest(w, r, "invalid_if_match", "If-Match must be a single strong ETag returned by this API")
+		return 0, false
+	}
+	return version, true
+}
+
+// notModified reports whether the If-None-Match header of r matches the given version, in
+// which case it has responded with 304 Not Modified.
+func notModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if v, ok := parseETag(tag); tag == "*" || (ok && v == version) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/buildinfo"
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/router"
+	"github.com/minab/internship-backend/internal/service"
+)
+
+type HealthHandler struct {
+	service *service.HealthService
+}
+
+func NewHealthHandler(service *service.HealthService) *HealthHandler {
+	return &HealthHandler{service: service}
+}
+
+// RegisterHealthRoutes sets up the unauthenticated probes for the orchestrator:
+// /healthz, /readyz and /version.
+func RegisterHealthRoutes(r *router.Router, healthService *service.HealthService) {
+	h := NewHealthHandler(healthService)
+	r.HandleFunc(http.MethodGet, "/healthz", h.Healthz)
+	r.HandleFunc(http.MethodGet, "/readyz", h.Readyz)
+	r.HandleFunc(http.MethodGet, "/version", h.Version)
+}
+
+// Healthz reports that the process is alive. It checks no dependencies.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]string{"status": model.HealthStatusOK})
+}
+
+// Readyz reports whether the server can serve traffic, with 503 if any check fails.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	readiness := h.service.Readiness(r.Context())
+	status := http.StatusOK
+	if readiness.Status != model.HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, readiness)
+}
+
+// Version reports the build of the running binary.
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, buildinfo.Get())
+}
+
+// writeHealth writes v as an uncached JSON response with the given status.
+func writeHealth(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
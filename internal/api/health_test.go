@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minab/internship-backend/internal/api"
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository/memory"
+	"github.com/minab/internship-backend/internal/router"
+	"github.com/minab/internship-backend/internal/service"
+)
+
+func TestReadyzHidesFailureDetails(t *testing.T) {
+	health := &memory.HealthStore{PingErr: errors.New("dial tcp 10.0.0.5:5432: connect: connection refused")}
+	r := router.New()
+	api.RegisterHealthRoutes(r, service.NewHealthService(health, false))
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if strings.Contains(string(body), "10.0.0.5") || strings.Contains(string(body), "refused") {
+		t.Fatalf("readiness exposes the error: %s", body)
+	}
+	var readiness model.Readiness
+	if err := json.Unmarshal(body, &readiness); err != nil {
+		t.Fatal(err)
+	}
+	if readiness.Status != model.HealthStatusUnavailable || readiness.Checks["database"].Status != model.HealthStatusUnavailable {
+		t.Fatalf("readiness = %+v, want the database unavailable", readiness)
+	}
+}
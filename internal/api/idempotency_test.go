@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLoginIsNeverReplayed(t *testing.T) {
+	c := newMemoryServer(t)
+	alice := c.register("alice@example.com")
+	retry := http.Header{"Idempotency-Key": {"login-1"}}
+	login := map[string]string{"email": alice.Email, "password": testPassword}
+
+	var tokens []string
+	for range 2 {
+		var out struct{ Token string }
+		resp := c.do(http.MethodPost, "/login", login, retry, &out)
+		wantStatus(t, resp, http.StatusOK)
+		if resp.Header.Get("Idempotent-Replayed") != "" || resp.Header.Get("Cache-Control") != "no-store" {
+			t.Fatalf("login response headers %v, want a fresh no-store response", resp.Header)
+		}
+		tokens = append(tokens, out.Token)
+	}
+	if tokens[0] == tokens[1] {
+		t.Fatal("the retried login returned the stored token")
+	}
+}
+
+func TestAnonymousKeyReuseIsRejected(t *testing.T) {
+	c := newMemoryServer(t)
+	key := http.Header{"Idempotency-Key": {"shared-key"}}
+	register := func(email string) (*http.Response, map[string]any) {
+		var out map[string]any
+		body := map[string]string{"full_name": "Test User", "email": email, "password": testPassword}
+		return c.do(http.MethodPost, "/register", body, key, &out), out
+	}
+
+	resp, alice := register("alice@example.com")
+	wantStatus(t, resp, http.StatusCreated)
+	resp, replayed := register("alice@example.com")
+	wantStatus(t, resp, http.StatusCreated)
+	if resp.Header.Get("Idempotent-Replayed") != "true" || replayed["id"] != alice["id"] {
+		t.Fatalf("retry of the same registration was not replayed: %v", replayed)
+	}
+
+	// The same client reusing the key for another payload is turned away, not served afresh
+	resp, _ = register("bob@example.com")
+	wantStatus(t, resp, http.StatusConflict)
+	resp = c.do(http.MethodPost, "/login", map[string]string{"email": "bob@example.com", "password": testPassword}, nil, nil)
+	wantStatus(t, resp, http.StatusUnauthorized)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+type ImpersonationHandler struct {
+	service *service.ImpersonationService
+}
+
+type ImpersonationResponse struct {
+	Token              string    `json:"token"`
+	ImpersonatedUserID string    `json:"impersonated_user_id"`
+	ExpiresAt          time.Time `json:"expires_at"`
+}
+
+func NewImpersonationHandler(service *service.ImpersonationService) *ImpersonationHandler {
+	return &ImpersonationHandler{service: service}
+}
+
+// @Summary Impersonate a user
+// @Description Admin only: issue a short-lived token to see the API as the given user. Responses to impersonated requests carry an X-Impersonated-By header, every such request is audited, and credential changes are blocked.
+// @Tags users
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param Idempotency-Key header string false "Only guards against concurrent duplicates: responses carrying credentials are never stored or replayed"
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} util.Problem "Invalid user ID"
+// @Failure 403 {object} util.Problem "This user cannot be impersonated"
+// @Failure 404 {object} util.Problem "User not found"
+// @Router /users/{id}/impersonate [post]
+// @Security BearerAuth
+func (h *ImpersonationHandler) Start(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	token, expiresAt, err := h.service.Start(r.Context(), claims, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(ImpersonationResponse{Token: token, ImpersonatedUserID: id, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,138 @@
+package api_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/minab/internship-backend/internal/api"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/testdb"
+)
+
+// newServer serves the API from the PostgreSQL repositories of an emptied test database,
+// or skips the test if there is none.
+func newServer(t *testing.T) *client {
+	db := testdb.Open(t)
+	c := serve(t, stores{
+		tx:          repository.NewTxManager(db),
+		users:       repository.NewUserRepository(db, db),
+		history:     repository.NewPasswordHistoryRepository(db),
+		emails:      repository.NewEmailVerificationRepository(db),
+		sessions:    repository.NewSessionRepository(db),
+		apiKeys:     repository.NewAPIKeyRepository(db),
+		audit:       repository.NewAuditRepository(db, db),
+		resets:      repository.NewPasswordResetRepository(db),
+		identities:  repository.NewIdentityRepository(db),
+		idempotency: repository.NewIdempotencyRepository(db),
+	})
+	c.db = db
+	return c
+}
+
+func TestRegisterAndListUsers(t *testing.T) {
+	c := newServer(t)
+	alice := c.register("alice@example.com")
+	bob := c.register("bob@example.com")
+	if alice.Role != "applicant" || alice.Version != 1 {
+		t.Fatalf("registered %+v, want an applicant at version 1", alice)
+	}
+
+	resp := c.do(http.MethodPost, "/register", map[string]string{"full_name": "Other", "email": "alice@example.com", "password": testPassword}, nil, nil)
+	wantStatus(t, resp, http.StatusConflict)
+	resp = c.do(http.MethodGet, "/users", nil, nil, nil)
+	wantStatus(t, resp, http.StatusUnauthorized)
+
+	var users []api.UserResponse
+	resp = c.do(http.MethodGet, "/users", nil, c.login(alice.Email), &users)
+	wantStatus(t, resp, http.StatusOK)
+	got := map[string]bool{}
+	for _, u := range users {
+		got[u.ID] = true
+	}
+	if len(users) != 2 || !got[alice.ID] || !got[bob.ID] {
+		t.Fatalf("ListUsers = %+v, want alice and bob", users)
+	}
+}
+
+func TestUpdateUserWithETag(t *testing.T) {
+	c := newServer(t)
+	alice := c.register("alice@example.com")
+	auth := c.login(alice.Email)
+	path := "/users/" + alice.ID
+
+	resp := c.do(http.MethodGet, path, nil, auth, nil)
+	wantStatus(t, resp, http.StatusOK)
+	tag := resp.Header.Get("ETag")
+	if tag != `"1"` {
+		t.Fatalf("ETag = %s, want \"1\"", tag)
+	}
+	cached := auth.Clone()
+	cached.Set("If-None-Match", tag)
+	wantStatus(t, c.do(http.MethodGet, path, nil, cached, nil), http.StatusNotModified)
+
+	profile := map[string]string{"full_name": "Alice Liddell", "email": alice.Email, "phone_number": "+15551234567"}
+	wantStatus(t, c.do(http.MethodPut, path, profile, auth, nil), http.StatusPreconditionRequired)
+
+	conditional := auth.Clone()
+	conditional.Set("If-Match", tag)
+	var updated api.UserResponse
+	resp = c.do(http.MethodPut, path, profile, conditional, &updated)
+	wantStatus(t, resp, http.StatusOK)
+	if updated.FullName != "Alice Liddell" || updated.PhoneNumber != "+15551234567" || updated.Version != 2 || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("updated %+v with ETag %s, want the new profile at version 2", updated, resp.Header.Get("ETag"))
+	}
+
+	// The first update consumed the version the stale ETag refers to
+	wantStatus(t, c.do(http.MethodPut, path, profile, conditional, nil), http.StatusPreconditionFailed)
+
+	// Only admins may change roles, and nobody may edit someone else's profile
+	profile["role"] = "admin"
+	conditional.Set("If-Match", `"2"`)
+	wantStatus(t, c.do(http.MethodPut, path, profile, conditional, nil), http.StatusForbidden)
+	bob := c.register("bob@example.com")
+	other := c.login(bob.Email)
+	other.Set("If-Match", "*")
+	delete(profile, "role")
+	wantStatus(t, c.do(http.MethodPut, path, profile, other, nil), http.StatusForbidden)
+
+	var stored struct {
+		name    string
+		version int64
+		audits  int
+	}
+	err := c.db.QueryRowContext(context.Background(),
+		"SELECT full_name, version, (SELECT count(*) FROM audit_events WHERE action = 'user.update' AND target_id = $1) FROM users WHERE id = $2",
+		alice.ID, alice.ID).Scan(&stored.name, &stored.version, &stored.audits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.name != "Alice Liddell" || stored.version != 2 || stored.audits != 1 {
+		t.Fatalf("stored %+v, want the one update and its audit event", stored)
+	}
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	c := newServer(t)
+	alice := c.register("alice@example.com")
+	auth := c.login(alice.Email)
+	wantStatus(t, c.do(http.MethodGet, "/users/"+alice.ID, nil, auth, nil), http.StatusOK)
+
+	// The token would be emailed by /forgot-password; only its SHA-256 is stored
+	const token = "integration-reset-token"
+	sum := sha256.Sum256([]byte(token))
+	resets := repository.NewPasswordResetRepository(c.db)
+	if err := resets.CreateToken(context.Background(), hex.EncodeToString(sum[:]), alice.ID, time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	reset := map[string]string{"token": token, "new_password": "Battery-Staple-77"}
+	wantStatus(t, c.do(http.MethodPost, "/reset-password", reset, nil, nil), http.StatusOK)
+	wantStatus(t, c.do(http.MethodPost, "/reset-password", reset, nil, nil), http.StatusBadRequest)
+	wantStatus(t, c.do(http.MethodGet, "/users/"+alice.ID, nil, auth, nil), http.StatusUnauthorized)
+	resp := c.do(http.MethodPost, "/login", map[string]string{"email": alice.Email, "password": "Battery-Staple-77"}, nil, nil)
+	wantStatus(t, resp, http.StatusOK)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+type OIDCHandler struct {
+	service        *service.OIDCService
+	sessionService *service.SessionService
+}
+
+func NewOIDCHandler(service *service.OIDCService, sessionService *service.SessionService) *OIDCHandler {
+	return &OIDCHandler{service: service, sessionService: sessionService}
+}
+
+// @Summary Start social login
+// @Description Redirect to the identity provider using the authorization-code flow with PKCE
+// @Tags auth
+// @Param provider path string true "Provider name, e.g. google"
+// @Success 302 {string} string "Redirect to the provider"
+// @Failure 404 {object} util.Problem "Unknown provider"
+// @Failure 502 {object} util.Problem "Identity provider unavailable"
+// @Router /auth/oidc/{provider}/login [get]
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.service.BeginLogin(r.Context(), r.PathValue("provider"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// @Summary Complete social login
+// @Description Exchange the authorization code, link or create the user and return a JWT token
+// @Tags auth
+// @Produce  json
+// @Param provider path string true "Provider name, e.g. google"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State returned by the provider"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} util.Problem "Invalid or expired login"
+// @Failure 403 {object} util.Problem "Email not verified"
+// @Failure 404 {object} util.Problem "Unknown provider"
+// @Router /auth/oidc/{provider}/callback [get]
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		badRequest(w, r, "login_denied", "Login was cancelled or denied: "+errCode)
+		return
+	}
+	code, state := q.Get("code"), q.Get("state")
+	if code == "" || state == "" {
+		badRequest(w, r, "missing_code", "Missing code or state")
+		return
+	}
+	user, err := h.service.CompleteLogin(r.Context(), provider, code, state)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLogin) {
+			slog.ErrorContext(r.Context(), "OIDC callback failed", "provider", provider, "error", err)
+		}
+		writeError(w, r, err)
+		return
+	}
+	session, err := h.sessionService.StartSession(r.Context(), user.ID, r.UserAgent(), util.ClientIP(r))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	token, err := util.GenerateJWT(user.ID, user.Email, user.Role, session.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
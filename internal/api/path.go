@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// uuidPattern matches the textual form of a UUID, which all entity IDs use.
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// pathID returns the path wildcard name of r, which must be a UUID. Otherwise it
+// responds with 400 and returns false, so malformed IDs never reach the database.
+func pathID(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	id := r.PathValue(name)
+	if !uuidPattern.MatchString(id) {
+		badRequest(w, r, "invalid_id", "Path parameter "+name+" must be a UUID")
+		return "", false
+	}
+	return id, true
+}
@@ -3,62 +3,71 @@ package api
 import (
 	"net/http"
 
+	"github.com/minab/internship-backend/internal/middleware"
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/router"
 	"github.com/minab/internship-backend/internal/service"
 )
 
-// RegisterPublicRoutes sets up public endpoints: login and register.
-func RegisterPublicRoutes(mux *http.ServeMux, userService *service.UserService, passwordResetService *service.PasswordResetService) {
-	authHandler := NewAuthHandler(userService)
+// RegisterPublicRoutes sets up public endpoints: login, social login, register, password reset
+// and email verification. r is the group of unauthenticated routes.
+func RegisterPublicRoutes(r *router.Router, userService *service.UserService, sessionService *service.SessionService, passwordResetService *service.PasswordResetService, oidcService *service.OIDCService, emailVerificationService *service.EmailVerificationService) {
+	authHandler := NewAuthHandler(userService, sessionService)
 	userHandler := NewUserHandler(userService)
+	passwordResetHandler := NewPasswordResetHandler(passwordResetService)
+	emailVerificationHandler := NewEmailVerificationHandler(emailVerificationService)
+	oidcHandler := NewOIDCHandler(oidcService, sessionService)
 
-	mux.HandleFunc("/api/v1/login", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		authHandler.Login(w, r)
-	})
-
-	mux.HandleFunc("/api/v1/register", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		userHandler.CreateUser(w, r)
-	})
+	r.HandleFunc(http.MethodPost, "/login", authHandler.Login)
+	r.HandleFunc(http.MethodPost, "/register", userHandler.CreateUser)
+	r.HandleFunc(http.MethodPost, "/forgot-password", passwordResetHandler.ForgotPassword)
+	r.HandleFunc(http.MethodPost, "/reset-password", passwordResetHandler.ResetPassword)
+	r.HandleFunc(http.MethodPost, "/verify-email", emailVerificationHandler.VerifyEmail)
 
-	passwordResetHandler := NewPasswordResetHandler(passwordResetService)
-	mux.HandleFunc("/api/v1/forgot-password", passwordResetHandler.ForgotPassword)
-	mux.HandleFunc("/api/v1/reset-password", passwordResetHandler.ResetPassword)
+	r.HandleFunc(http.MethodGet, "/auth/oidc/{provider}/login", oidcHandler.Login)
+	r.HandleFunc(http.MethodGet, "/auth/oidc/{provider}/callback", oidcHandler.Callback)
 }
 
-func RegisterProtectedRoutes(mux *http.ServeMux, userService *service.UserService) {
+// RegisterProtectedRoutes sets up the endpoints that need credentials. r is the group of
+// authenticated routes; role, scope and session requirements are added per route.
+func RegisterProtectedRoutes(r *router.Router, userService *service.UserService, sessionService *service.SessionService, apiKeyService *service.APIKeyService, impersonationService *service.ImpersonationService, auditService *service.AuditService) {
 	userHandler := NewUserHandler(userService)
+	sessionHandler := NewSessionHandler(sessionService)
+	apiKeyHandler := NewAPIKeyHandler(apiKeyService, userService)
+	impersonationHandler := NewImpersonationHandler(impersonationService)
+	auditHandler := NewAuditHandler(auditService)
+
+	requireAdmin := router.Use("role:"+model.RoleAdmin, middleware.RequireRole(model.RoleAdmin))
+	requireUsersRead := router.Use("scope:"+model.ScopeUsersRead, middleware.RequireScope(model.ScopeUsersRead))
+	requireUsersWrite := router.Use("scope:"+model.ScopeUsersWrite, middleware.RequireScope(model.ScopeUsersWrite))
+	requireSessionsManage := router.Use("scope:"+model.ScopeSessionsManage, middleware.RequireScope(model.ScopeSessionsManage))
+	requireSession := router.Use("session-only", middleware.RequireSession)
+	denyImpersonation := router.Use("no-impersonation", middleware.DenyImpersonation)
+
+	r.HandleFunc(http.MethodGet, "/users", userHandler.ListUsers, requireUsersRead)
+	r.HandleFunc(http.MethodGet, "/users/{id}", userHandler.GetUser, requireUsersRead)
+	r.HandleFunc(http.MethodPut, "/users/{id}", userHandler.ReplaceUser, requireUsersWrite)
+	r.HandleFunc(http.MethodPatch, "/users/{id}", userHandler.PatchUser, requireUsersWrite)
+	r.HandleFunc(http.MethodDelete, "/users/{id}", userHandler.DeleteUser, requireAdmin, requireUsersWrite)
+	r.HandleFunc(http.MethodDelete, "/users/{id}/sessions", sessionHandler.RevokeUserSessions, requireAdmin, requireSessionsManage)
+	r.HandleFunc(http.MethodPost, "/users/{id}/impersonate", impersonationHandler.Start, requireSession, denyImpersonation, requireAdmin)
 
-	// /api/v1/users - GET only (listing users, protected)
-	mux.HandleFunc("/api/v1/users", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			userHandler.ListUsers(w, r)
-			return
-		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
+	r.HandleFunc(http.MethodGet, "/me/sessions", sessionHandler.ListMySessions, requireSessionsManage)
+	r.HandleFunc(http.MethodDelete, "/me/sessions", sessionHandler.RevokeMyOtherSessions, requireSessionsManage, denyImpersonation)
+	r.HandleFunc(http.MethodDelete, "/me/sessions/{id}", sessionHandler.RevokeMySession, requireSessionsManage, denyImpersonation)
 
-	// /api/v1/users/{id} - GET
-	mux.HandleFunc("/api/v1/users/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			userHandler.GetUser(w, r)
-			return
-		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
+	// API keys can never be used to manage API keys or service accounts, and
+	// neither can an admin who is impersonating a user.
+	keys := r.Group("", requireSession)
+	keys.HandleFunc(http.MethodGet, "/me/api-keys", apiKeyHandler.ListMyKeys, denyImpersonation)
+	keys.HandleFunc(http.MethodPost, "/me/api-keys", apiKeyHandler.CreateMyKey, denyImpersonation)
+	keys.HandleFunc(http.MethodDelete, "/me/api-keys/{id}", apiKeyHandler.RevokeMyKey, denyImpersonation)
 
-	// /api/v1/users/update/{id} - PUT or PATCH
-	mux.HandleFunc("/api/v1/users/update/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut || r.Method == http.MethodPatch {
-			userHandler.UpdateUser(w, r)
-			return
-		}
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
+	admin := r.Group("", requireSession, requireAdmin)
+	admin.HandleFunc(http.MethodPost, "/service-accounts", apiKeyHandler.CreateServiceAccount)
+	admin.HandleFunc(http.MethodGet, "/service-accounts/{id}/keys", apiKeyHandler.ListServiceAccountKeys)
+	admin.HandleFunc(http.MethodPost, "/service-accounts/{id}/keys", apiKeyHandler.CreateServiceAccountKey)
+	admin.HandleFunc(http.MethodDelete, "/service-accounts/{id}/keys/{keyID}", apiKeyHandler.RevokeServiceAccountKey)
+	admin.HandleFunc(http.MethodGet, "/audit-events", auditHandler.ListEvents)
+	admin.HandleFunc(http.MethodGet, "/audit-events/verify", auditHandler.VerifyChain)
 }
@@ -0,0 +1,160 @@
+package api_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/minab/internship-backend/internal/api"
+	"github.com/minab/internship-backend/internal/middleware"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/repository/memory"
+	"github.com/minab/internship-backend/internal/router"
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/testdb"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+const testPassword = "Correct-Horse-42"
+
+func TestMain(m *testing.M) {
+	util.ConfigureJWT([]byte("integration-test-signing-key-0123"))
+	// Cheap hashing keeps the suite fast; the parameters are not what is under test.
+	if err := util.ConfigurePasswordHashing(util.PasswordHashing{
+		Algorithm:         util.HashAlgorithmArgon2id,
+		Argon2Memory:      8,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}); err != nil {
+		panic(err)
+	}
+	os.Exit(testdb.Run(m))
+}
+
+// stores are what the services of the test server are built on.
+type stores struct {
+	tx          repository.Transactor
+	users       repository.UserStore
+	history     repository.PasswordHistoryStore
+	emails      repository.EmailVerificationStore
+	sessions    repository.SessionStore
+	apiKeys     repository.APIKeyStore
+	audit       repository.AuditStore
+	resets      repository.PasswordResetStore
+	identities  repository.IdentityStore
+	idempotency repository.IdempotencyStore
+}
+
+// newMemoryServer serves the API from in-memory stores, for tests that need no SQL.
+func newMemoryServer(t *testing.T) *client {
+	db := memory.NewDB()
+	return serve(t, stores{
+		tx:          db,
+		users:       memory.NewUserStore(db),
+		history:     memory.NewPasswordHistoryStore(db),
+		emails:      memory.NewEmailVerificationStore(db),
+		sessions:    memory.NewSessionStore(db),
+		apiKeys:     memory.NewAPIKeyStore(db),
+		audit:       memory.NewAuditStore(db),
+		resets:      memory.NewPasswordResetStore(db),
+		identities:  memory.NewIdentityStore(db),
+		idempotency: memory.NewIdempotencyStore(db),
+	})
+}
+
+// serve wires the services to s and serves the API routes as cmd/server does, without
+// rate limits.
+func serve(t *testing.T, s stores) *client {
+	passwordService := service.NewPasswordService(service.PasswordPolicy{MinLength: 10, HistorySize: 3}, s.users, s.history)
+	emailVerificationService := service.NewEmailVerificationService(s.emails, s.users)
+	userService := service.NewUserService(s.tx, s.users, passwordService, emailVerificationService)
+	sessionService := service.NewSessionService(s.sessions)
+	apiKeyService := service.NewAPIKeyService(s.apiKeys, s.users)
+	auditService := service.NewAuditService(s.audit)
+	impersonationService := service.NewImpersonationService(s.users, auditService)
+	passwordResetService := service.NewPasswordResetService(s.tx, s.resets, s.users, s.sessions, s.apiKeys, s.emails, passwordService)
+	oidcService := service.NewOIDCService(nil, s.identities, s.users)
+	idempotent := router.Use("idempotency", middleware.Idempotency(service.NewIdempotencyService(s.idempotency)))
+
+	r := router.New()
+	v1 := r.Group("/api/v1")
+	api.RegisterPublicRoutes(v1.Group("", idempotent), userService, sessionService, passwordResetService, oidcService, emailVerificationService)
+	api.RegisterProtectedRoutes(v1.Group("",
+		router.Use("auth", middleware.Authenticate(sessionService, apiKeyService)),
+		router.Use("audit-impersonation", middleware.AuditImpersonation(auditService)),
+		idempotent,
+	), userService, sessionService, apiKeyService, impersonationService, auditService)
+
+	srv := httptest.NewServer(middleware.RequestMeta(r))
+	t.Cleanup(srv.Close)
+	return &client{t: t, url: srv.URL + "/api/v1"}
+}
+
+// client sends JSON requests to the test server.
+type client struct {
+	t   *testing.T
+	url string
+	// db is the PostgreSQL database behind the server, if any.
+	db *sql.DB
+}
+
+// do sends body as JSON with the given headers, decodes the response into out if it is
+// not nil and returns the response.
+func (c *client) do(method, path string, body any, header http.Header, out any) *http.Response {
+	c.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.url+path, &buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			c.t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// register creates a user and returns them.
+func (c *client) register(email string) api.UserResponse {
+	c.t.Helper()
+	var user api.UserResponse
+	resp := c.do(http.MethodPost, "/register", map[string]string{"full_name": "Test User", "email": email, "password": testPassword}, nil, &user)
+	wantStatus(c.t, resp, http.StatusCreated)
+	return user
+}
+
+// login returns the Authorization header of a new session of the user.
+func (c *client) login(email string) http.Header {
+	c.t.Helper()
+	var out struct{ Token string }
+	resp := c.do(http.MethodPost, "/login", map[string]string{"email": email, "password": testPassword}, nil, &out)
+	wantStatus(c.t, resp, http.StatusOK)
+	return http.Header{"Authorization": {"Bearer " + out.Token}}
+}
+
+func wantStatus(t *testing.T, resp *http.Response, want int) {
+	t.Helper()
+	if resp.StatusCode != want {
+		t.Fatalf("%s %s: status %d, want %d", resp.Request.Method, resp.Request.URL.Path, resp.StatusCode, want)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+type SessionHandler struct {
+	service *service.SessionService
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func NewSessionHandler(service *service.SessionService) *SessionHandler {
+	return &SessionHandler{service: service}
+}
+
+// @Summary List my sessions
+// @Description List the active sessions (devices) of the authenticated user
+// @Tags sessions
+// @Produce  json
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} util.Problem "Unauthorized"
+// @Failure 500 {object} util.Problem "Failed to list sessions"
+// @Router /me/sessions [get]
+// @Security BearerAuth
+func (h *SessionHandler) ListMySessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	sessions, err := h.service.ListSessions(r.Context(), claims.UserID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := []SessionResponse{}
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == claims.SessionID,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary Revoke one of my sessions
+// @Description Log out the given session of the authenticated user
+// @Tags sessions
+// @Produce  json
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} util.Problem "Invalid session ID"
+// @Failure 404 {object} util.Problem "Session not found"
+// @Router /me/sessions/{id} [delete]
+// @Security BearerAuth
+func (h *SessionHandler) RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := h.service.RevokeSession(r.Context(), claims.UserID, id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// @Summary Revoke my other sessions
+// @Description Log out every session of the authenticated user except the current one
+// @Tags sessions
+// @Produce  json
+// @Success 200 {object} map[string]int64
+// @Failure 500 {object} util.Problem "Failed to revoke sessions"
+// @Router /me/sessions [delete]
+// @Security BearerAuth
+func (h *SessionHandler) RevokeMyOtherSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
+		return
+	}
+	n, err := h.service.RevokeOtherSessions(r.Context(), claims.UserID, claims.SessionID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": n})
+}
+
+// @Summary Terminate all sessions of a user
+// @Description Admin only: log the given user out of every device
+// @Tags sessions
+// @Produce  json
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]int64
+// @Failure 400 {object} util.Problem "Invalid user ID"
+// @Failure 403 {object} util.Problem "Forbidden"
+// @Failure 500 {object} util.Problem "Failed to revoke sessions"
+// @Router /users/{id}/sessions [delete]
+// @Security BearerAuth
+func (h *SessionHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	n, err := h.service.RevokeAllSessions(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"revoked": n})
+}
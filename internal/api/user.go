@@ -3,7 +3,6 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/minab/internship-backend/internal/model"
@@ -16,12 +15,30 @@ type UserHandler struct {
 }
 
 type UserResponse struct {
-	ID          string    `json:"id"`
-	FullName    string    `json:"full_name"`
-	Email       string    `json:"email"`
-	PhoneNumber string    `json:"phone_number"`
-	Role        string    `json:"role"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               string    `json:"id"`
+	FullName         string    `json:"full_name"`
+	Email            string    `json:"email"`
+	PhoneNumber      string    `json:"phone_number"`
+	Role             string    `json:"role"`
+	IsServiceAccount bool      `json:"is_service_account"`
+	CreatedAt        time.Time `json:"created_at"`
+	// Version is incremented by every update and sent as the ETag.
+	Version int64 `json:"version"`
+	// PendingEmail is a new email address awaiting verification.
+	PendingEmail string `json:"pending_email,omitempty"`
+}
+
+func newUserResponse(u *model.User) UserResponse {
+	return UserResponse{
+		ID:               u.ID,
+		FullName:         u.FullName,
+		Email:            u.Email,
+		PhoneNumber:      u.PhoneNumber,
+		Role:             u.Role,
+		IsServiceAccount: u.IsServiceAccount,
+		CreatedAt:        u.CreatedAt,
+		Version:          u.Version,
+	}
 }
 
 func NewUserHandler(service *service.UserService) *UserHandler {
@@ -29,160 +46,187 @@ func NewUserHandler(service *service.UserService) *UserHandler {
 }
 
 // @Summary Get a user by ID
-// @Description Get a single user by their ID
+// @Description Get a single user by their ID. The ETag header carries the version to send in If-Match when updating the user.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} UserResponse
-// @Failure 400 {string} string "Missing user ID"
-// @Failure 404 {string} string "User not found"
+// @Header 200 {string} ETag "Current version of the user"
+// @Success 304 "Cached copy is current"
+// @Failure 400 {object} util.Problem "Invalid user ID"
+// @Failure 404 {object} util.Problem "User not found"
 // @Router /users/{id} [get]
 // @Security BearerAuth
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		http.Error(w, "Missing user ID", http.StatusBadRequest)
+	id, ok := pathID(w, r, "id")
+	if !ok {
 		return
 	}
-	id := parts[len(parts)-1]
 	user, err := h.service.GetUser(r.Context(), id)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", etag(user.Version))
+	if notModified(w, r, user.Version) {
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(newUserResponse(user))
 }
 
 // @Summary Create a new user
-// @Description Create a user with the given data
+// @Description Register a new applicant. The role cannot be chosen: a body with a role field is rejected, and only admins can change a user's role afterwards.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param user body model.CreateUserRequest true "User Data"
+// @Param Idempotency-Key header string false "Makes retries safe: the first response for this key is replayed for 24h"
 // @Success 201 {object} UserResponse
-// @Failure 400 {string} string "Invalid request body"
-// @Failure 500 {string} string "Failed to create user"
+// @Failure 400 {object} util.Problem "Invalid request body or password rejected by policy"
+// @Failure 500 {object} util.Problem "Failed to create user"
 // @Router /register [post]
 // @Security BearerAuth
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	var req model.CreateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	createdUser, err := h.service.CreateUser(r.Context(), &req)
 	if err != nil {
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	// Map to response struct without password
-	resp := UserResponse{
-		ID:          createdUser.ID,
-		FullName:    createdUser.FullName,
-		Email:       createdUser.Email,
-		PhoneNumber: createdUser.PhoneNumber,
-		Role:        createdUser.Role,
-		CreatedAt:   createdUser.CreatedAt,
-	}
+	resp := newUserResponse(createdUser)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(resp)
 }
 
-// @Summary Update a user
-// @Description Update fields of a user
+// @Summary Replace a user
+// @Description Replace the profile with the given one. Users may only update themselves and only admins may change the role. A new email takes effect once confirmed through the link sent to it and is returned as pending_email until then. The If-Match header must carry the ETag from the last read of the user, or "*" to update unconditionally.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path string true "User ID"
-// @Param updates body map[string]interface{} true "Fields to update"
+// @Param If-Match header string true "ETag of the user being updated"
+// @Param user body model.UpdateUserRequest true "Full profile"
 // @Success 200 {object} UserResponse
-// @Failure 400 {string} string "Invalid request body or missing user ID"
-// @Failure 404 {string} string "User not found"
-// @Failure 500 {string} string "Failed to update user"
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} util.Problem "Invalid user ID, request body or password rejected by policy"
+// @Failure 403 {object} util.Problem "Not allowed to update this user or field"
+// @Failure 404 {object} util.Problem "User not found"
+// @Failure 409 {object} util.Problem "Email already in use"
+// @Failure 412 {object} util.Problem "User was modified since it was read"
+// @Failure 428 {object} util.Problem "Missing If-Match header"
 // @Router /users/{id} [put]
 // @Security BearerAuth
-func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut && r.Method != http.MethodPatch {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (h *UserHandler) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	h.updateUser(w, r, func(id string, req *model.UpdateUserRequest) bool {
+		return decodeJSON(w, r, req)
+	})
+}
+
+// @Summary Patch a user
+// @Description Apply a JSON Merge Patch (RFC 7396) to the profile, where null clears a field. The rules of PUT apply to the result.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path string true "User ID"
+// @Param If-Match header string true "ETag of the user being updated"
+// @Param user body model.UpdateUserRequest true "Merge patch"
+// @Success 200 {object} UserResponse
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400 {object} util.Problem "Invalid user ID, request body or password rejected by policy"
+// @Failure 403 {object} util.Problem "Not allowed to update this user or field"
+// @Failure 404 {object} util.Problem "User not found"
+// @Failure 409 {object} util.Problem "Email already in use"
+// @Failure 412 {object} util.Problem "User was modified since it was read"
+// @Failure 415 {object} util.Problem "Body is not a merge patch"
+// @Failure 428 {object} util.Problem "Missing If-Match header"
+// @Router /users/{id} [patch]
+// @Security BearerAuth
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	h.updateUser(w, r, func(id string, req *model.UpdateUserRequest) bool {
+		existing, err := h.service.GetUser(r.Context(), id)
+		if err != nil {
+			writeError(w, r, err)
+			return false
+		}
+		// The role is left out so that it is only written when the patch sets it
+		current := model.UpdateUserRequest{
+			FullName:    existing.FullName,
+			Email:       existing.Email,
+			PhoneNumber: existing.PhoneNumber,
+		}
+		return decodeMergePatch(w, r, current, req)
+	})
+}
+
+// updateUser runs a conditional update of the user in the path with the request that
+// decode produces. decode writes the response and returns false on failure.
+func (h *UserHandler) updateUser(w http.ResponseWriter, r *http.Request, decode func(id string, req *model.UpdateUserRequest) bool) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
 		return
 	}
-	parts := strings.Split(r.URL.Path, "/")
-	if len(parts) < 3 {
-		http.Error(w, "Missing user ID", http.StatusBadRequest)
+	id, ok := pathID(w, r, "id")
+	if !ok {
 		return
 	}
-	id := parts[len(parts)-1]
-
-	// Fetch the existing user
-	existing, err := h.service.GetUser(r.Context(), id)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	version, ok := requireIfMatch(w, r)
+	if !ok {
 		return
 	}
-
-	// Decode the request body into a map
-	var updates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req model.UpdateUserRequest
+	if !decode(id, &req) {
 		return
 	}
 
-	// Update only provided fields
-	if v, ok := updates["full_name"].(string); ok {
-		existing.FullName = v
-	}
-	if v, ok := updates["email"].(string); ok {
-		existing.Email = v
-	}
-	if v, ok := updates["phone_number"].(string); ok {
-		existing.PhoneNumber = v
-	}
-	if v, ok := updates["role"].(string); ok {
-		existing.Role = v
-	}
-	if v, ok := updates["password"].(string); ok && v != "" {
-		hashed, err := util.HashPassword(v)
-		if err != nil {
-			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
-			return
-		}
-		existing.Password = hashed
+	updated, pendingEmail, err := h.service.UpdateUser(r.Context(), claims, id, version, &req)
+	if err != nil {
+		writeError(w, r, err)
+		return
 	}
+	resp := newUserResponse(updated)
+	resp.PendingEmail = pendingEmail
+	w.Header().Set("ETag", etag(updated.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
 
-	// Save the updated user
-	if _, err := h.service.UpdateUser(r.Context(), id, existing); err != nil {
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+// @Summary Delete a user
+// @Description Admin only: delete a user together with their sessions, API keys and other owned records
+// @Tags users
+// @Param id path string true "User ID"
+// @Success 204 "User deleted"
+// @Failure 400 {object} util.Problem "Invalid user ID"
+// @Failure 403 {object} util.Problem "Forbidden or deleting yourself"
+// @Failure 404 {object} util.Problem "User not found"
+// @Failure 409 {object} util.Problem "User is still referenced by other records"
+// @Router /users/{id} [delete]
+// @Security BearerAuth
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := util.ClaimsFromContext(r.Context())
+	if !ok {
+		unauthorized(w, r)
 		return
 	}
-
-	// Fetch the updated user from DB to ensure all fields are fresh
-	updated, err := h.service.GetUser(r.Context(), id)
-	if err != nil {
-		http.Error(w, "Failed to fetch updated user", http.StatusInternalServerError)
+	id, ok := pathID(w, r, "id")
+	if !ok {
 		return
 	}
-
-	// Map to response struct (do NOT include password)
-	resp := UserResponse{
-		ID:          updated.ID,
-		FullName:    updated.FullName,
-		Email:       updated.Email,
-		PhoneNumber: updated.PhoneNumber,
-		Role:        updated.Role,
-		CreatedAt:   updated.CreatedAt,
+	if err := h.service.DeleteUser(r.Context(), claims, id); err != nil {
+		writeError(w, r, err)
+		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // @Summary List all users
@@ -191,25 +235,18 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 // @Accept  json
 // @Produce  json
 // @Success 200 {array} UserResponse
-// @Failure 500 {string} string "Failed to list users"
+// @Failure 500 {object} util.Problem "Failed to list users"
 // @Router /users [get]
 // @Security BearerAuth
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := h.service.ListUsers(r.Context())
 	if err != nil {
-		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	var resp []UserResponse
 	for _, u := range users {
-		resp = append(resp, UserResponse{
-			ID:          u.ID,
-			FullName:    u.FullName,
-			Email:       u.Email,
-			PhoneNumber: u.PhoneNumber,
-			Role:        u.Role,
-			CreatedAt:   u.CreatedAt,
-		})
+		resp = append(resp, newUserResponse(u))
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
@@ -0,0 +1,27 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/minab/internship-backend/internal/api"
+	"github.com/minab/internship-backend/internal/model"
+)
+
+func TestRegisterCannotChooseRole(t *testing.T) {
+	c := newMemoryServer(t)
+
+	for _, role := range []string{model.RoleAdmin, model.RoleApplicant} {
+		body := map[string]string{"full_name": "Mallory", "email": "mallory@example.com", "password": testPassword, "role": role}
+		wantStatus(t, c.do(http.MethodPost, "/register", body, nil, nil), http.StatusBadRequest)
+	}
+	resp := c.do(http.MethodPost, "/login", map[string]string{"email": "mallory@example.com", "password": testPassword}, nil, nil)
+	wantStatus(t, resp, http.StatusUnauthorized)
+
+	mallory := c.register("mallory@example.com")
+	var stored api.UserResponse
+	wantStatus(t, c.do(http.MethodGet, "/users/"+mallory.ID, nil, c.login(mallory.Email), &stored), http.StatusOK)
+	if mallory.Role != model.RoleApplicant || stored.Role != model.RoleApplicant {
+		t.Fatalf("registered with role %q, stored %q; want %q", mallory.Role, stored.Role, model.RoleApplicant)
+	}
+}
@@ -1,20 +1,121 @@
+// Package db opens the PostgreSQL connection pools: the primary, which takes every
+// write, and an optional read replica for read-only queries that tolerate replication lag.
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func Connect(connectionString string) (*sql.DB, error) {
-	db, err := sql.Open("postgres", connectionString)
+// Config holds the connection strings, the connection pool limits, applied to the
+// primary and the replica alike, and how long to keep retrying the initial connection.
+type Config struct {
+	URL             string
+	ReplicaURL      string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	ConnectTimeout  time.Duration
+}
+
+// Backoff between attempts of the initial connection.
+const (
+	initialBackoff = 500 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// DB is the primary connection pool and the replica pool, if one is configured.
+type DB struct {
+	Primary *sql.DB
+	Replica *sql.DB
+}
+
+// Reader returns the pool for read-only queries: the replica, or the primary without one.
+func (d *DB) Reader() *sql.DB {
+	if d.Replica != nil {
+		return d.Replica
+	}
+	return d.Primary
+}
+
+// Close closes both pools.
+func (d *DB) Close() error {
+	var errs []error
+	errs = append(errs, d.Primary.Close())
+	if d.Replica != nil {
+		errs = append(errs, d.Replica.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Connect opens the primary pool and, if cfg.ReplicaURL is set, the replica pool, and
+// checks that both answer. As the database may still be starting up, failed attempts
+// are retried with exponential backoff for up to cfg.ConnectTimeout. Every query gets
+// a span as a child of the span of the request it is made for.
+func Connect(ctx context.Context, cfg Config) (*DB, error) {
+	primary, err := open(ctx, cfg, "primary", cfg.URL)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.Ping(); err != nil {
+	d := &DB{Primary: primary}
+	if cfg.ReplicaURL != "" {
+		if d.Replica, err = open(ctx, cfg, "replica", cfg.ReplicaURL); err != nil {
+			primary.Close()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func open(ctx context.Context, cfg Config, role, dsn string) (*sql.DB, error) {
+	db, err := otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open %s database: %w", role, err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	if err := ping(ctx, db, role, cfg.ConnectTimeout); err != nil {
+		db.Close()
 		return nil, err
 	}
-	fmt.Println("Connected to Postgres database")
 	return db, nil
 }
+
+// ping pings db until it answers, waiting longer after each failed attempt, and gives
+// up with the last error once timeout has passed or ctx is done.
+func ping(ctx context.Context, db *sql.DB, role string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() == nil {
+			slog.Warn("Database not reachable, retrying", "database", role, "attempt", attempt, "retry_in", backoff, "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("connect to %s database after %d attempts: %w", role, attempt, err)
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
@@ -0,0 +1,82 @@
+// Package logging configures structured logging through log/slog. Every record is
+// scrubbed of secrets and, when logged with a request context, carries the request ID
+// and the authenticated user.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// Config selects the level and format of log output.
+type Config struct {
+	// Level is debug, info, warn or error.
+	Level string
+	// Format is json or text.
+	Format string
+}
+
+// New returns a logger writing records at or above the configured level to w.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: use debug, info, warn or error", cfg.Level)
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "json", "":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: use json or text", cfg.Format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+// Setup makes a logger writing to stderr the default for slog and the log package.
+func Setup(cfg Config) error {
+	logger, err := New(os.Stderr, cfg)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// contextHandler adds the request ID and user ID of the request a record is logged
+// for, and the trace and span IDs of the current span, taken from the context passed
+// to the logger.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if meta, ok := util.RequestMetaFromContext(ctx); ok {
+		r.AddAttrs(slog.String("request_id", meta.RequestID))
+		if meta.UserID != "" {
+			r.AddAttrs(slog.String("user_id", meta.UserID))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
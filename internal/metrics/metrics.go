@@ -0,0 +1,133 @@
+// Package metrics defines the Prometheus metrics of the server and serves them in the
+// text exposition format. The collectors are package-level so any layer can record to
+// them without threading a registry through every constructor.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the server, plus the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+// UnmatchedRoute labels requests that matched no route, so unknown paths cannot create
+// new series.
+const UnmatchedRoute = "unmatched"
+
+var (
+	// HTTPRequests counts handled requests by method, route pattern and status.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPRequestDuration observes the latency of requests by method and route pattern.
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by method and route pattern.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// Logins counts login attempts by method (password or oidc) and result.
+	Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts, by method and result (success, failure or error).",
+	}, []string{"method", "result"})
+
+	// Emails counts emails by result (sent or failed).
+	Emails = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "emails_total",
+		Help: "Emails handed to the mail server, by result (sent or failed).",
+	}, []string{"result"})
+
+	// JobRuns counts runs of background jobs by job and result (success or error).
+	JobRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "background_job_runs_total",
+		Help: "Runs of background jobs, by job and result (success or error).",
+	}, []string{"job", "result"})
+
+	// JobDuration observes how long background jobs take.
+	JobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "background_job_duration_seconds",
+		Help:    "Duration of background job runs, by job.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"job"})
+
+	// JobLastSuccess is the Unix time a job last succeeded.
+	JobLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "background_job_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of a background job.",
+	}, []string{"job"})
+
+	// JobItems counts the records processed by background jobs, by job.
+	JobItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "background_job_items_total",
+		Help: "Records processed by background jobs, by job.",
+	}, []string{"job"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		Logins,
+		Emails,
+		JobRuns,
+		JobDuration,
+		JobLastSuccess,
+		JobItems,
+	)
+}
+
+// RegisterDB exposes the connection pool statistics of db (open, in use and idle
+// connections, waits and closes) with the label db_name=name.
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// ObserveRequest records a handled HTTP request.
+func ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	method = methodLabel(method)
+	HTTPRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	HTTPRequestDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// ObserveJob records a run of a background job that processed items records.
+func ObserveJob(job string, items int64, elapsed time.Duration, err error) {
+	JobDuration.WithLabelValues(job).Observe(elapsed.Seconds())
+	if err != nil {
+		JobRuns.WithLabelValues(job, "error").Inc()
+		return
+	}
+	JobRuns.WithLabelValues(job, "success").Inc()
+	JobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	JobItems.WithLabelValues(job).Add(float64(items))
+}
+
+// methodLabel maps methods other than the standard ones to "other", as clients can send
+// any method.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
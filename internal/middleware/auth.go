@@ -2,26 +2,104 @@ package middleware
 
 import (
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/minab/internship-backend/internal/service"
 	"github.com/minab/internship-backend/internal/util"
 )
 
-func JWTAuth(next http.Handler) http.Handler {
+// Authenticate accepts either a Bearer JWT bound to an active session or an API key,
+// given as "Authorization: Bearer <key>" or in the X-API-Key header, and stores the
+// resulting claims in the request context.
+func Authenticate(sessions *service.SessionService, apiKeys *service.APIKeyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential := r.Header.Get("X-API-Key")
+			if credential == "" {
+				authHeader := r.Header.Get("Authorization")
+				if !strings.HasPrefix(authHeader, "Bearer ") {
+					util.HTTPError(w, r, http.StatusUnauthorized, "missing_credentials", "Missing or invalid Authorization header")
+					return
+				}
+				credential = strings.TrimPrefix(authHeader, "Bearer ")
+			}
+
+			var claims *util.Claims
+			if service.IsAPIKey(credential) {
+				c, err := apiKeys.Authenticate(r.Context(), credential)
+				if err != nil {
+					util.HTTPError(w, r, http.StatusUnauthorized, "invalid_api_key", "Invalid or expired API key")
+					return
+				}
+				claims = c
+			} else {
+				c, err := util.ParseJWT(credential)
+				if err != nil {
+					util.HTTPError(w, r, http.StatusUnauthorized, "invalid_token", "Invalid token")
+					return
+				}
+				// Impersonation tokens are bound to the admin's session.
+				sessionOwner := c.UserID
+				if c.IsImpersonated() {
+					sessionOwner = c.ImpersonatorID
+				}
+				if err := sessions.ValidateSession(r.Context(), c.SessionID, sessionOwner); err != nil {
+					util.HTTPError(w, r, http.StatusUnauthorized, "session_invalid", "Session expired or revoked")
+					return
+				}
+				claims = c
+			}
+			// Optionally set claims in context for downstream handlers
+			if meta, ok := util.RequestMetaFromContext(r.Context()); ok {
+				meta.UserID = claims.UserID
+			}
+			r = r.WithContext(util.ContextWithClaims(r.Context(), claims))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole only lets through requests whose claims carry one of the given roles.
+// It must run after Authenticate.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := util.ClaimsFromContext(r.Context())
+			if !ok || !slices.Contains(roles, claims.Role) {
+				util.HTTPError(w, r, http.StatusForbidden, "forbidden", "Forbidden")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope rejects API keys that were not granted scope. Login sessions pass.
+// It must run after Authenticate.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := util.ClaimsFromContext(r.Context())
+			if !ok || !claims.HasScope(scope) {
+				util.HTTPError(w, r, http.StatusForbidden, "missing_scope", "API key is missing scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects API keys, for endpoints that must only be reachable from an
+// interactive login (for example managing the keys themselves).
+// It must run after Authenticate.
+func RequireSession(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			http.Error(w, "Missing or invalid Authorization header", http.StatusUnauthorized)
-			return
-		}
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		claims, err := util.ParseJWT(tokenStr)
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		claims, ok := util.ClaimsFromContext(r.Context())
+		if !ok || claims.IsAPIKey() {
+			util.HTTPError(w, r, http.StatusForbidden, "session_required", "This endpoint requires a login session")
 			return
 		}
-		// Optionally set claims in context for downstream handlers
-		r = r.WithContext(util.ContextWithClaims(r.Context(), claims))
 		next.ServeHTTP(w, r)
 	})
 }
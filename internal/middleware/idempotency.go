@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+const (
+	// maxIdempotencyKeyLength caps client-supplied idempotency keys.
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodyBytes caps the request and stored response bodies of idempotent requests.
+	maxIdempotentBodyBytes = 1 << 20
+)
+
+// unreplayedHeaders are response headers that describe a single response and are not
+// stored for replays.
+var unreplayedHeaders = []string{"Date", "Content-Length", "X-Request-ID"}
+
+// Idempotency makes POST requests carrying an Idempotency-Key header safe to retry. The
+// first response for a key, per authenticated user, is stored and replayed to retries
+// with the same method, path and body; reusing the key for a different request gets 409.
+// Keys of unauthenticated requests are scoped to the client IP, so callers behind
+// different addresses that pick the same key never see each other's responses.
+//
+// Server errors are not stored so that the request can be retried, and neither are
+// responses marked Cache-Control: no-store, which is how handlers that issue tokens or
+// API keys keep secrets out of the database; retries of those requests are handled
+// afresh. On protected routes it must run after Authenticate.
+func Idempotency(idempotency *service.IdempotencyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !isVisibleASCII(key, maxIdempotencyKeyLength) {
+				util.HTTPError(w, r, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be 1-255 visible ASCII characters")
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					util.HTTPError(w, r, http.StatusRequestEntityTooLarge, "body_too_large", "Request body is too large")
+					return
+				}
+				util.HTTPError(w, r, http.StatusBadRequest, "invalid_body", "Could not read request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := requestHash(r, body)
+			scope := anonymousScope(r)
+			if claims, ok := util.ClaimsFromContext(r.Context()); ok {
+				scope = claims.UserID
+			}
+			stored, err := idempotency.Begin(r.Context(), scope, key, hash)
+			switch {
+			case errors.Is(err, service.ErrIdempotencyKeyReused):
+				util.HTTPError(w, r, http.StatusConflict, service.ErrIdempotencyKeyReused.Code, service.ErrIdempotencyKeyReused.Message)
+				return
+			case errors.Is(err, service.ErrIdempotencyInProgress):
+				util.HTTPError(w, r, http.StatusConflict, service.ErrIdempotencyInProgress.Code, service.ErrIdempotencyInProgress.Message)
+				return
+			case err != nil:
+				slog.ErrorContext(r.Context(), "Failed to look up idempotency key", "error", err)
+				util.HTTPError(w, r, http.StatusInternalServerError, "internal_error", "An unexpected error occurred")
+				return
+			case stored != nil:
+				replay(w, stored)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			// Release the key if the handler fails or panics; the request context may be done by then.
+			defer func() {
+				if !completed {
+					if err := idempotency.Release(context.WithoutCancel(r.Context()), scope, key); err != nil {
+						slog.ErrorContext(r.Context(), "Failed to release idempotency key", "error", err)
+					}
+				}
+			}()
+			next.ServeHTTP(rec, r)
+			if rec.status >= http.StatusInternalServerError || rec.overflow || noStore(w.Header()) {
+				return
+			}
+			header := w.Header().Clone()
+			for _, name := range unreplayedHeaders {
+				header.Del(name)
+			}
+			if err := idempotency.Complete(context.WithoutCancel(r.Context()), scope, key, rec.status, header, rec.body.Bytes()); err != nil {
+				slog.ErrorContext(r.Context(), "Failed to store idempotent response", "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// requestHash fingerprints the method, path and body of a request.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// anonymousScope scopes the key of an unauthenticated request to the client IP. The IP
+// is hashed so that the scope does not store it.
+func anonymousScope(r *http.Request) string {
+	sum := sha256.Sum256([]byte(util.ClientIP(r)))
+	return model.IdempotencyScopeAnonymous + ":" + hex.EncodeToString(sum[:])
+}
+
+// noStore reports whether a response is marked as not to be stored.
+func noStore(header http.Header) bool {
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replay writes a stored response, marked with an Idempotent-Replayed header.
+func replay(w http.ResponseWriter, record *model.IdempotencyRecord) {
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.Body)
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	// overflow is set when the body exceeded maxIdempotentBodyBytes and was not kept.
+	overflow bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > maxIdempotentBodyBytes {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
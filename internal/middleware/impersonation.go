@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/service"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// AuditImpersonation marks responses to impersonated requests with the X-Impersonated-By
+// header, so clients can show a banner, and writes every such request to the audit log
+// before it is handled. If the event cannot be recorded the request is refused.
+// It must run after Authenticate.
+func AuditImpersonation(audit *service.AuditService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := util.ClaimsFromContext(r.Context())
+			if !ok || !claims.IsImpersonated() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("X-Impersonated-By", claims.ImpersonatorID)
+			err := audit.Record(r.Context(), &model.AuditEvent{
+				ActorID:        claims.UserID,
+				ImpersonatorID: claims.ImpersonatorID,
+				Action:         model.AuditActionImpersonatedRequest,
+				TargetType:     "http",
+				TargetID:       r.Method + " " + r.URL.Path,
+				Metadata:       map[string]any{"query": r.URL.RawQuery},
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to audit impersonated request", "method", r.Method, "path", r.URL.Path, "error", err)
+				util.HTTPError(w, r, http.StatusServiceUnavailable, "audit_unavailable", "Could not record impersonated request")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DenyImpersonation blocks sensitive endpoints, such as credential changes, while an
+// admin is impersonating a user. It must run after Authenticate.
+func DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims, ok := util.ClaimsFromContext(r.Context()); ok && claims.IsImpersonated() {
+			util.HTTPError(w, r, http.StatusForbidden, "impersonation_denied", "Not allowed while impersonating a user")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/minab/internship-backend/internal/metrics"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// Metrics counts every request and observes its latency by method, route pattern and
+// status. The route pattern is set in the request metadata by the router, so it must
+// run inside RequestMeta; requests that match no route are counted as unmatched.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		var route string
+		if meta, ok := util.RequestMetaFromContext(r.Context()); ok {
+			route = meta.Route
+		}
+		metrics.ObserveRequest(r.Method, route, sw.status, time.Since(start))
+	})
+}
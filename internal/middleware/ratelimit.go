@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/minab/internship-backend/internal/util"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdleTTL is how long the bucket of a client that sends no requests is kept.
+const rateLimitIdleTTL = 10 * time.Minute
+
+// RateLimitKey identifies the client a request is counted against.
+type RateLimitKey func(r *http.Request) string
+
+// ClientIPKey counts requests per client IP address. Forwarding headers only count
+// when they come from a trusted proxy (see util.ClientIP), so clients cannot rotate
+// them to get a fresh bucket with every request.
+func ClientIPKey(r *http.Request) string {
+	return "ip:" + util.ClientIP(r)
+}
+
+// UserKey counts requests per authenticated user, falling back to the client IP.
+func UserKey(r *http.Request) string {
+	if claims, ok := util.ClaimsFromContext(r.Context()); ok {
+		return "user:" + claims.UserID
+	}
+	return ClientIPKey(r)
+}
+
+// RateLimiter keeps a token bucket per client.
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+	key   RateLimitKey
+
+	mu        sync.Mutex
+	clients   map[string]*rateLimitClient
+	lastSweep time.Time
+}
+
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows every client perMinute requests per minute with bursts of up
+// to burst requests. A perMinute of 0 or less disables the limit.
+func NewRateLimiter(perMinute, burst int, key RateLimitKey) *RateLimiter {
+	limit := rate.Inf
+	if perMinute > 0 {
+		limit = rate.Limit(float64(perMinute) / 60)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{limit: limit, burst: burst, key: key, clients: make(map[string]*rateLimitClient)}
+}
+
+// reserve takes a token for the client of r and returns how long it has to wait when none is left.
+func (l *RateLimiter) reserve(r *http.Request) (time.Duration, bool) {
+	if l.limit == rate.Inf {
+		return 0, true
+	}
+	now := time.Now()
+	key := l.key(r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateLimitIdleTTL {
+		for k, c := range l.clients {
+			if now.Sub(c.lastSeen) > rateLimitIdleTTL {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		c = &rateLimitClient{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[key] = c
+	}
+	c.lastSeen = now
+	if c.limiter.AllowN(now, 1) {
+		return 0, true
+	}
+	res := c.limiter.ReserveN(now, 1)
+	wait := res.DelayFrom(now)
+	res.CancelAt(now)
+	return wait, false
+}
+
+// RateLimit rejects requests of clients that exceeded the limit of limiter with 429 and a
+// Retry-After header.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wait, ok := limiter.reserve(r)
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				util.HTTPError(w, r, http.StatusTooManyRequests, "rate_limited", "Too many requests; retry later")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
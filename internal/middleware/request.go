@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// maxRequestIDLength caps client-supplied request IDs.
+const maxRequestIDLength = 128
+
+// RequestMeta assigns every request an ID, taken from a valid incoming X-Request-ID
+// header or freshly generated, echoes it in the response and stores it together with
+// the client IP and user agent in the request context.
+func RequestMeta(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		meta := &util.RequestMeta{
+			RequestID: id,
+			IPAddress: util.ClientIP(r),
+			UserAgent: r.UserAgent(),
+		}
+		next.ServeHTTP(w, r.WithContext(util.ContextWithRequestMeta(r.Context(), meta)))
+	})
+}
+
+func validRequestID(id string) bool {
+	return isVisibleASCII(id, maxRequestIDLength)
+}
+
+// isVisibleASCII reports whether s is a non-empty string of at most maxLen printable,
+// non-space ASCII characters, which is safe to echo in headers and logs.
+func isVisibleASCII(s string, maxLen int) bool {
+	if s == "" || len(s) > maxLen {
+		return false
+	}
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// untracedPaths are polled by probes and would only add noise to traces.
+var untracedPaths = map[string]bool{"/healthz": true, "/readyz": true}
+
+// Tracing starts a server span for every request, continuing the trace of an incoming
+// W3C traceparent header. Once the router has matched the request the span is named
+// after the route pattern, e.g. "GET /api/v1/users/{id}", so it must run inside
+// RequestMeta.
+func Tracing(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if meta, ok := util.RequestMetaFromContext(r.Context()); ok && meta.Route != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + meta.Route)
+			span.SetAttributes(semconv.HTTPRoute(meta.Route))
+		}
+	})
+	return otelhttp.NewHandler(named, "HTTP request",
+		otelhttp.WithFilter(func(r *http.Request) bool { return !untracedPaths[r.URL.Path] }),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }),
+	)
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// APIKey is a named, scoped and expiring credential for scripts and service accounts.
+// Only a hash of the secret is stored; the plaintext is shown once on creation.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,scope"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=365"`
+}
+
+// API key scopes.
+const (
+	ScopeUsersRead      = "users:read"
+	ScopeUsersWrite     = "users:write"
+	ScopeSessionsManage = "sessions:manage"
+)
+
+// APIKeyScopes lists every scope an API key may be granted.
+var APIKeyScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeSessionsManage}
+
+// IsValidScope reports whether scope is a known API key scope.
+func IsValidScope(scope string) bool {
+	return slices.Contains(APIKeyScopes, scope)
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"reflect"
+	"time"
+)
+
+// AuditEvent is an append-only record of a change made to the system. Each event
+// stores the hash of its predecessor, forming a tamper-evident chain.
+type AuditEvent struct {
+	ID             int64                  `json:"id"`
+	ActorID        string                 `json:"actor_id"`
+	ImpersonatorID string                 `json:"impersonator_id,omitempty"`
+	Action         string                 `json:"action"`
+	TargetType     string                 `json:"target_type"`
+	TargetID       string                 `json:"target_id"`
+	Changes        map[string]FieldChange `json:"changes,omitempty"`
+	IPAddress      string                 `json:"ip_address"`
+	RequestID      string                 `json:"request_id"`
+	Metadata       map[string]any         `json:"metadata,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+	PrevHash       string                 `json:"prev_hash"`
+	Hash           string                 `json:"hash"`
+}
+
+// FieldChange is the value of a field before and after a change.
+type FieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditFilter narrows an audit log query. Empty fields match everything.
+type AuditFilter struct {
+	ActorID        string
+	ImpersonatorID string
+	Action         string
+	TargetType     string
+	TargetID       string
+	RequestID      string
+	From           *time.Time
+	To             *time.Time
+	Limit          int
+	Offset         int
+}
+
+// AuditChainReport is the result of verifying the audit log hash chain.
+type AuditChainReport struct {
+	Valid bool  `json:"valid"`
+	Count int64 `json:"checked"`
+	// FirstInvalidID is the first event whose hash or link does not match, if any.
+	FirstInvalidID int64 `json:"first_invalid_id,omitempty"`
+}
+
+// Audit actions.
+const (
+	AuditActionUserCreate          = "user.create"
+	AuditActionUserUpdate          = "user.update"
+	AuditActionUserDelete          = "user.delete"
+	AuditActionEmailChangeRequest  = "user.email_change_request"
+	AuditActionPasswordChange      = "user.password_change"
+	AuditActionPasswordRehash      = "user.password_rehash"
+	AuditActionPasswordResetIssue  = "password_reset.request"
+	AuditActionSessionCreate       = "session.create"
+	AuditActionSessionRevoke       = "session.revoke"
+	AuditActionSessionRevokeAll    = "session.revoke_all"
+	AuditActionAPIKeyCreate        = "api_key.create"
+	AuditActionAPIKeyRevoke        = "api_key.revoke"
+	AuditActionAPIKeyRevokeAll     = "api_key.revoke_all"
+	AuditActionIdentityLink        = "identity.link"
+	AuditActionImpersonationStart  = "impersonation.start"
+	AuditActionImpersonatedRequest = "impersonation.request"
+)
+
+// RedactedValue stands in for secret values, such as password hashes, in audit diffs.
+const RedactedValue = "[redacted]"
+
+// DiffFields returns the fields whose values differ between before and after.
+// A nil before describes a newly created entity.
+func DiffFields(before, after map[string]any) map[string]FieldChange {
+	changes := make(map[string]FieldChange)
+	for k, a := range after {
+		b, ok := before[k]
+		if !ok || !reflect.DeepEqual(a, b) {
+			changes[k] = FieldChange{Before: b, After: a}
+		}
+	}
+	for k, b := range before {
+		if _, ok := after[k]; !ok {
+			changes[k] = FieldChange{Before: b}
+		}
+	}
+	return changes
+}
+
+// AuditFields returns the user fields tracked in audit diffs. The password is excluded.
+func (u *User) AuditFields() map[string]any {
+	return map[string]any{
+		"full_name":          u.FullName,
+		"email":              u.Email,
+		"phone_number":       u.PhoneNumber,
+		"role":               u.Role,
+		"is_service_account": u.IsServiceAccount,
+	}
+}
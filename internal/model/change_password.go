@@ -2,8 +2,10 @@ package model
 
 import "time"
 
+// PasswordResetToken is a pending password reset. Only the SHA-256 of the token is
+// stored; the token itself is sent to the user.
 type PasswordResetToken struct {
-	Token     string
+	TokenHash string
 	UserID    string
 	ExpiresAt time.Time
 }
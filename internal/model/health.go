@@ -0,0 +1,20 @@
+package model
+
+// Health check statuses.
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthCheck is the result of checking one dependency. The reason a check failed is
+// logged rather than returned, as the probes are unauthenticated.
+type HealthCheck struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+}
+
+// Readiness reports whether the server can serve traffic, with the result of every check.
+type Readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is the first response to a request sent with an Idempotency-Key
+// header, replayed when the request is retried.
+type IdempotencyRecord struct {
+	// Scope is the ID of the authenticated user, or IdempotencyScopeAnonymous followed by
+	// a hash of the client IP for unauthenticated requests.
+	Scope string
+	Key   string
+	// RequestHash fingerprints the method, path and body of the first request.
+	RequestHash string
+	// StatusCode is 0 while the first request is still being handled.
+	StatusCode int
+	Header     map[string][]string
+	Body       []byte
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// IdempotencyScopeAnonymous prefixes the scopes of unauthenticated requests.
+const IdempotencyScopeAnonymous = "anonymous"
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+type UserIdentity struct {
+	ID        string
+	UserID    string
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// OIDCLoginState holds the per-attempt secrets of an authorization-code + PKCE login
+// between the redirect to the provider and the callback.
+type OIDCLoginState struct {
+	State        string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
@@ -1,21 +1,73 @@
 package model
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type User struct {
-	ID          string    `json:"id"`
-	FullName    string    `json:"full_name"`
-	Email       string    `json:"email"`
-	Password    string    `json:"password"`
-	PhoneNumber string    `json:"phone_number"`
-	Role        string    `json:"role"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID               string    `json:"id"`
+	FullName         string    `json:"full_name"`
+	Email            string    `json:"email"`
+	Password         string    `json:"password"`
+	PhoneNumber      string    `json:"phone_number"`
+	Role             string    `json:"role"`
+	IsServiceAccount bool      `json:"is_service_account"`
+	CreatedAt        time.Time `json:"created_at"`
+	// Version is incremented by every profile update and used for optimistic concurrency.
+	Version int64 `json:"version"`
 }
 
+// CreateUserRequest is a public registration. It has no role: every registered user
+// is an applicant, and only an admin can change the role afterwards.
 type CreateUserRequest struct {
-	FullName    string `json:"full_name" validate:"required"`
-	Email       string `json:"email" validate:"required,email"`
+	FullName    string `json:"full_name" validate:"required,max=100"`
+	Email       string `json:"email" validate:"required,email,max=100"`
 	Password    string `json:"password" validate:"required"`
-	PhoneNumber string `json:"phone_number"`
-	Role        string `json:"role"`
+	PhoneNumber string `json:"phone_number" validate:"omitempty,phone"`
+}
+
+// UpdateUserRequest is the full, replaceable representation of a user's profile. PUT
+// sends it whole; PATCH sends a JSON Merge Patch that is applied to the current one.
+// An omitted phone number is cleared, while an omitted role and password are left
+// unchanged. Only admins may change the role, and a new email only takes effect once
+// it has been verified.
+type UpdateUserRequest struct {
+	FullName    string  `json:"full_name" validate:"required,max=100"`
+	Email       string  `json:"email" validate:"required,email,max=100"`
+	PhoneNumber string  `json:"phone_number,omitempty" validate:"omitempty,phone"`
+	Role        string  `json:"role,omitempty" validate:"omitempty,role"`
+	Password    *string `json:"password,omitempty" validate:"omitempty,min=1"`
+}
+
+// EmailVerificationToken confirms that a user controls a new email address before
+// it replaces their current one. Only a hash of the token is stored.
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    string
+	Email     string
+	ExpiresAt time.Time
+}
+
+// CreateServiceAccountRequest is the body an admin sends to create a service account.
+// Service accounts have no usable password and can only authenticate with API keys.
+type CreateServiceAccountRequest struct {
+	FullName string `json:"full_name" validate:"required,max=100"`
+	Email    string `json:"email" validate:"required,email,max=100"`
+	Role     string `json:"role" validate:"omitempty,role"`
+}
+
+// User roles.
+const (
+	RoleApplicant = "applicant"
+	RoleMentor    = "mentor"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every user role.
+var Roles = []string{RoleApplicant, RoleMentor, RoleAdmin}
+
+// IsValidRole reports whether role is a known user role.
+func IsValidRole(role string) bool {
+	return slices.Contains(Roles, role)
 }
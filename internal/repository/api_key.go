@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// APIKeyStore stores API keys by the hash of their secret. Keys are revoked rather than
+// deleted, and only active keys are listed.
+type APIKeyStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) APIKeyStore
+	CreateKey(ctx context.Context, key *model.APIKey) (*model.APIKey, error)
+	GetKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+	ListKeys(ctx context.Context, userID string) ([]*model.APIKey, error)
+	TouchKey(ctx context.Context, id string, usedAt time.Time) error
+	RevokeKey(ctx context.Context, userID, id string, revokedAt time.Time) error
+	RevokeAllKeys(ctx context.Context, userID string, revokedAt time.Time) (int64, error)
+}
+
+type APIKeyRepository struct {
+	db Querier
+}
+
+func NewAPIKeyRepository(db Querier) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *APIKeyRepository) WithTx(tx *sql.Tx) APIKeyStore {
+	return &APIKeyRepository{db: tx}
+}
+
+// CreateKey inserts a new API key and fills in its ID and creation timestamp.
+func (r *APIKeyRepository) CreateKey(ctx context.Context, key *model.APIKey) (*model.APIKey, error) {
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+			key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt,
+		).Scan(&key.ID, &key.CreatedAt)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionAPIKeyCreate, "api_key", key.ID)
+		event.Metadata = map[string]any{"user_id": key.UserID, "name": key.Name, "prefix": key.Prefix, "scopes": key.Scopes}
+		return appendAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GetKeyByHash retrieves an API key by the hash of its secret, including revoked and expired ones.
+func (r *APIKeyRepository) GetKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	k := &model.APIKey{}
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at FROM api_keys WHERE key_hash=$1", keyHash,
+	).Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt, &k.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// ListKeys retrieves the keys of a user that have not been revoked, newest first.
+func (r *APIKeyRepository) ListKeys(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at FROM api_keys WHERE user_id=$1 AND revoked_at IS NULL ORDER BY created_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*model.APIKey
+	for rows.Next() {
+		k := &model.APIKey{}
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt, &k.RevokedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// TouchKey updates the last-used timestamp of a key.
+func (r *APIKeyRepository) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE api_keys SET last_used_at=$1 WHERE id=$2", usedAt, id)
+	return err
+}
+
+// RevokeKey marks a key of a user as revoked. It returns sql.ErrNoRows if the user
+// has no active key with that ID.
+func (r *APIKeyRepository) RevokeKey(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE api_keys SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL",
+			revokedAt, id, userID,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		event := auditEvent(ctx, model.AuditActionAPIKeyRevoke, "api_key", id)
+		event.Metadata = map[string]any{"user_id": userID}
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// RevokeAllKeys marks every active key of a user as revoked and returns how many were
+// revoked.
+func (r *APIKeyRepository) RevokeAllKeys(ctx context.Context, userID string, revokedAt time.Time) (int64, error) {
+	var n int64
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE api_keys SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL",
+			revokedAt, userID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err = res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionAPIKeyRevokeAll, "user", userID)
+		event.Metadata = map[string]any{"revoked": n}
+		return appendAuditEvent(ctx, tx, event)
+	})
+	return n, err
+}
@@ -0,0 +1,261 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// auditChainLock is the advisory lock key that serializes appends to the audit hash chain.
+const auditChainLock = 0x61756469
+
+// AuditStore stores the audit log, an append-only hash chain whose integrity
+// VerifyChain checks.
+type AuditStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) AuditStore
+	CreateEvent(ctx context.Context, event *model.AuditEvent) error
+	ListEvents(ctx context.Context, f *model.AuditFilter) ([]*model.AuditEvent, error)
+	VerifyChain(ctx context.Context) (*model.AuditChainReport, error)
+}
+
+// AuditRepository appends events to db and serves ListEvents and VerifyChain from
+// replica, which may be db itself when there is no read replica.
+type AuditRepository struct {
+	db      Querier
+	replica Querier
+}
+
+func NewAuditRepository(db, replica Querier) *AuditRepository {
+	return &AuditRepository{db: db, replica: replica}
+}
+
+// WithTx returns a copy of the repository that runs its statements, reads included, in tx.
+func (r *AuditRepository) WithTx(tx *sql.Tx) AuditStore {
+	return &AuditRepository{db: tx, replica: tx}
+}
+
+// CreateEvent appends an event to the audit log and fills in its ID, timestamp and hashes.
+// A missing IP address or request ID is taken from the request metadata in ctx.
+func (r *AuditRepository) CreateEvent(ctx context.Context, event *model.AuditEvent) error {
+	if meta, ok := util.RequestMetaFromContext(ctx); ok {
+		if event.IPAddress == "" {
+			event.IPAddress = meta.IPAddress
+		}
+		if event.RequestID == "" {
+			event.RequestID = meta.RequestID
+		}
+	}
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// ListEvents retrieves the events matching the filter from the read replica, newest first.
+func (r *AuditRepository) ListEvents(ctx context.Context, f *model.AuditFilter) ([]*model.AuditEvent, error) {
+	var (
+		where []string
+		args  []any
+	)
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorID != "" {
+		add("actor_id=$%d", f.ActorID)
+	}
+	if f.ImpersonatorID != "" {
+		add("impersonator_id=$%d", f.ImpersonatorID)
+	}
+	if f.Action != "" {
+		add("action=$%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type=$%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id=$%d", f.TargetID)
+	}
+	if f.RequestID != "" {
+		add("request_id=$%d", f.RequestID)
+	}
+	if f.From != nil {
+		add("created_at >= $%d", f.From.UTC())
+	}
+	if f.To != nil {
+		add("created_at < $%d", f.To.UTC())
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_events"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, f.Limit, f.Offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := r.replica.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*model.AuditEvent
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// VerifyChain recomputes the hash of every event in order and reports the first
+// event whose stored hash or link to its predecessor does not match.
+func (r *AuditRepository) VerifyChain(ctx context.Context) (*model.AuditChainReport, error) {
+	rows, err := r.replica.QueryContext(ctx, "SELECT "+auditColumns+" FROM audit_events ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &model.AuditChainReport{Valid: true}
+	prev := ""
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		report.Count++
+		hash, err := auditEventHash(e)
+		if err != nil {
+			return nil, err
+		}
+		if e.PrevHash != prev || e.Hash != hash {
+			report.Valid = false
+			report.FirstInvalidID = e.ID
+			break
+		}
+		prev = e.Hash
+	}
+	return report, rows.Err()
+}
+
+const auditColumns = "id, actor_id, impersonator_id, action, target_type, target_id, changes, ip_address, request_id, metadata, created_at, prev_hash, hash"
+
+func scanAuditEvent(rows *sql.Rows) (*model.AuditEvent, error) {
+	e := &model.AuditEvent{}
+	var changes, metadata []byte
+	if err := rows.Scan(&e.ID, &e.ActorID, &e.ImpersonatorID, &e.Action, &e.TargetType, &e.TargetID, &changes, &e.IPAddress, &e.RequestID, &metadata, &e.CreatedAt, &e.PrevHash, &e.Hash); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(changes, &e.Changes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+		return nil, err
+	}
+	e.CreatedAt = e.CreatedAt.UTC()
+	return e, nil
+}
+
+// auditEvent builds an event for a change to a target, filling in the actor from the
+// request's claims and the IP address and request ID from its metadata.
+func auditEvent(ctx context.Context, action, targetType, targetID string) *model.AuditEvent {
+	event := &model.AuditEvent{Action: action, TargetType: targetType, TargetID: targetID}
+	if claims, ok := util.ClaimsFromContext(ctx); ok {
+		event.ActorID = claims.UserID
+		event.ImpersonatorID = claims.ImpersonatorID
+	}
+	if meta, ok := util.RequestMetaFromContext(ctx); ok {
+		event.IPAddress = meta.IPAddress
+		event.RequestID = meta.RequestID
+	}
+	return event
+}
+
+// appendAuditEvent inserts an event within tx, linking it to the hash of the latest event.
+// Appends are serialized with a transaction-scoped advisory lock so the chain stays linear.
+func appendAuditEvent(ctx context.Context, tx *sql.Tx, event *model.AuditEvent) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return err
+	}
+	err := tx.QueryRowContext(ctx, "SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&event.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err := normalizeAuditEvent(event); err != nil {
+		return err
+	}
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	hash, err := auditEventHash(event)
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+
+	changes, err := json.Marshal(event.Changes)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRowContext(ctx,
+		"INSERT INTO audit_events (actor_id, impersonator_id, action, target_type, target_id, changes, ip_address, request_id, metadata, created_at, prev_hash, hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id",
+		event.ActorID, event.ImpersonatorID, event.Action, event.TargetType, event.TargetID, changes, event.IPAddress, event.RequestID, metadata, event.CreatedAt, event.PrevHash, event.Hash,
+	).Scan(&event.ID)
+}
+
+// normalizeAuditEvent round-trips the changes and metadata through JSON so the values
+// hashed on insert are identical to those read back from the JSONB columns.
+func normalizeAuditEvent(event *model.AuditEvent) error {
+	if event.Changes == nil {
+		event.Changes = map[string]model.FieldChange{}
+	}
+	if event.Metadata == nil {
+		event.Metadata = map[string]any{}
+	}
+	for _, v := range []any{&event.Changes, &event.Metadata} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditEventHash returns sha256(prev_hash || canonical JSON of the event) in hex.
+// The ID is excluded because it is assigned by the database after hashing.
+func auditEventHash(e *model.AuditEvent) (string, error) {
+	payload, err := json.Marshal(struct {
+		ActorID        string                       `json:"actor_id"`
+		ImpersonatorID string                       `json:"impersonator_id"`
+		Action         string                       `json:"action"`
+		TargetType     string                       `json:"target_type"`
+		TargetID       string                       `json:"target_id"`
+		Changes        map[string]model.FieldChange `json:"changes"`
+		IPAddress      string                       `json:"ip_address"`
+		RequestID      string                       `json:"request_id"`
+		Metadata       map[string]any               `json:"metadata"`
+		CreatedAt      string                       `json:"created_at"`
+	}{e.ActorID, e.ImpersonatorID, e.Action, e.TargetType, e.TargetID, e.Changes, e.IPAddress, e.RequestID, e.Metadata, e.CreatedAt.UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash), payload...))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -8,29 +8,70 @@ import (
 	"github.com/minab/internship-backend/internal/model"
 )
 
+// PasswordResetStore stores password reset tokens by their hash. Deleting a token is
+// how it is consumed, so DeleteToken fails for a token another reset already used.
+type PasswordResetStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) PasswordResetStore
+	CreateToken(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error
+	GetToken(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error)
+	DeleteToken(ctx context.Context, tokenHash string) error
+	DeleteUserTokens(ctx context.Context, userID string) (int64, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
 type PasswordResetRepository struct {
-	db *sql.DB
+	db Querier
 }
 
-func NewPasswordResetRepository(db *sql.DB) *PasswordResetRepository {
+func NewPasswordResetRepository(db Querier) *PasswordResetRepository {
 	return &PasswordResetRepository{db: db}
 }
 
-func (r *PasswordResetRepository) CreateToken(ctx context.Context, token, userID string, expiresAt time.Time) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO password_reset_tokens (token, user_id, expires_at) VALUES ($1, $2, $3)", token, userID, expiresAt)
-	return err
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *PasswordResetRepository) WithTx(tx *sql.Tx) PasswordResetStore {
+	return &PasswordResetRepository{db: tx}
 }
 
-func (r *PasswordResetRepository) GetToken(ctx context.Context, token string) (*model.PasswordResetToken, error) {
-	row := r.db.QueryRowContext(ctx, "SELECT token, user_id, expires_at FROM password_reset_tokens WHERE token=$1", token)
+// CreateToken stores the hash of a reset token and records the request in the audit log.
+func (r *PasswordResetRepository) CreateToken(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO password_reset_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)", tokenHash, userID, expiresAt); err != nil {
+			return err
+		}
+		return appendAuditEvent(ctx, tx, auditEvent(ctx, model.AuditActionPasswordResetIssue, "user", userID))
+	})
+}
+
+func (r *PasswordResetRepository) GetToken(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	row := r.db.QueryRowContext(ctx, "SELECT token_hash, user_id, expires_at FROM password_reset_tokens WHERE token_hash=$1", tokenHash)
 	var t model.PasswordResetToken
-	if err := row.Scan(&t.Token, &t.UserID, &t.ExpiresAt); err != nil {
+	if err := row.Scan(&t.TokenHash, &t.UserID, &t.ExpiresAt); err != nil {
 		return nil, err
 	}
 	return &t, nil
 }
 
-func (r *PasswordResetRepository) DeleteToken(ctx context.Context, token string) error {
-	_, err := r.db.ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE token=$1", token)
-	return err
+// DeleteExpired removes the tokens that expired before now and returns how many were removed.
+func (r *PasswordResetRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return execCount(ctx, r.db, "DELETE FROM password_reset_tokens WHERE expires_at <= $1", now)
+}
+
+// DeleteToken removes a reset token. It returns sql.ErrNoRows if the token does not exist,
+// such as when a concurrent reset already consumed it.
+func (r *PasswordResetRepository) DeleteToken(ctx context.Context, tokenHash string) error {
+	n, err := execCount(ctx, r.db, "DELETE FROM password_reset_tokens WHERE token_hash=$1", tokenHash)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserTokens removes every outstanding reset token of a user and returns how many
+// were removed.
+func (r *PasswordResetRepository) DeleteUserTokens(ctx context.Context, userID string) (int64, error) {
+	return execCount(ctx, r.db, "DELETE FROM password_reset_tokens WHERE user_id=$1", userID)
 }
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// EmailVerificationStore stores pending email changes by the hash of their token. A user
+// has at most one pending change, and a token is consumed by its first use.
+type EmailVerificationStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) EmailVerificationStore
+	CreateToken(ctx context.Context, t *model.EmailVerificationToken) error
+	ConsumeToken(ctx context.Context, tokenHash string) (*model.EmailVerificationToken, error)
+	DeleteUserTokens(ctx context.Context, userID string) (int64, error)
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type EmailVerificationRepository struct {
+	db Querier
+}
+
+func NewEmailVerificationRepository(db Querier) *EmailVerificationRepository {
+	return &EmailVerificationRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *EmailVerificationRepository) WithTx(tx *sql.Tx) EmailVerificationStore {
+	return &EmailVerificationRepository{db: tx}
+}
+
+// CreateToken stores a verification token for a new email address, replacing any
+// pending one of the user, and records the request in the audit log.
+func (r *EmailVerificationRepository) CreateToken(ctx context.Context, t *model.EmailVerificationToken) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM email_verification_tokens WHERE user_id=$1", t.UserID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO email_verification_tokens (token_hash, user_id, email, expires_at) VALUES ($1, $2, $3, $4)",
+			t.TokenHash, t.UserID, t.Email, t.ExpiresAt,
+		); err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionEmailChangeRequest, "user", t.UserID)
+		event.Metadata = map[string]any{"email": t.Email}
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// DeleteExpired removes the tokens that expired before now and returns how many were removed.
+func (r *EmailVerificationRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return execCount(ctx, r.db, "DELETE FROM email_verification_tokens WHERE expires_at <= $1", now)
+}
+
+// ConsumeToken deletes and returns a verification token, so each token can be used only once.
+func (r *EmailVerificationRepository) ConsumeToken(ctx context.Context, tokenHash string) (*model.EmailVerificationToken, error) {
+	t := &model.EmailVerificationToken{}
+	err := r.db.QueryRowContext(ctx,
+		"DELETE FROM email_verification_tokens WHERE token_hash=$1 RETURNING token_hash, user_id, email, expires_at", tokenHash,
+	).Scan(&t.TokenHash, &t.UserID, &t.Email, &t.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteUserTokens cancels the pending email change of a user, returning how many tokens
+// were removed.
+func (r *EmailVerificationRepository) DeleteUserTokens(ctx context.Context, userID string) (int64, error) {
+	return execCount(ctx, r.db, "DELETE FROM email_verification_tokens WHERE user_id=$1", userID)
+}
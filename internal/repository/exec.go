@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"context"
+)
+
+// execCount runs a statement and returns the number of rows it affected.
+func execCount(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
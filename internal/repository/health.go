@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SchemaVersion is the schema version this code expects. It must match the version
+// migrations/schema.sql records in schema_migrations, and is bumped with every schema change.
+const SchemaVersion = 3
+
+// HealthStore reports whether the database is reachable and which schema version it has.
+type HealthStore interface {
+	Ping(ctx context.Context) error
+	AppliedSchemaVersion(ctx context.Context) (int, error)
+}
+
+type HealthRepository struct {
+	db *sql.DB
+}
+
+func NewHealthRepository(db *sql.DB) *HealthRepository {
+	return &HealthRepository{db: db}
+}
+
+// Ping checks that a connection to the database can be made.
+func (r *HealthRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// AppliedSchemaVersion returns the latest version recorded in schema_migrations, or 0 if none is.
+func (r *HealthRepository) AppliedSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := r.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
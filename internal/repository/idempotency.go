@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// IdempotencyStore stores idempotency keys. A key is reserved before its request is
+// handled, so of concurrent requests with one key only the first proceeds, and then
+// either completed with the response to replay or released.
+type IdempotencyStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) IdempotencyStore
+	Reserve(ctx context.Context, record *model.IdempotencyRecord) (bool, error)
+	GetRecord(ctx context.Context, scope, key string) (*model.IdempotencyRecord, error)
+	Complete(ctx context.Context, scope, key string, status int, header map[string][]string, body []byte) error
+	Release(ctx context.Context, scope, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type IdempotencyRepository struct {
+	db Querier
+}
+
+func NewIdempotencyRepository(db Querier) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *IdempotencyRepository) WithTx(tx *sql.Tx) IdempotencyStore {
+	return &IdempotencyRepository{db: tx}
+}
+
+// Reserve claims the key of record for a request that is about to be handled. It reports
+// false when the key is already held by an unexpired record; an expired one is replaced.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record *model.IdempotencyRecord) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (scope, idempotency_key, request_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (scope, idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_headers = NULL,
+			response_body = NULL, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.created_at`,
+		record.Scope, record.Key, record.RequestHash, record.CreatedAt, record.ExpiresAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// GetRecord retrieves the record of a key, including one whose request is still in progress.
+func (r *IdempotencyRepository) GetRecord(ctx context.Context, scope, key string) (*model.IdempotencyRecord, error) {
+	record := &model.IdempotencyRecord{}
+	var status sql.NullInt64
+	var header []byte
+	err := r.db.QueryRowContext(ctx,
+		"SELECT scope, idempotency_key, request_hash, status_code, response_headers, response_body, created_at, expires_at FROM idempotency_keys WHERE scope=$1 AND idempotency_key=$2",
+		scope, key,
+	).Scan(&record.Scope, &record.Key, &record.RequestHash, &status, &header, &record.Body, &record.CreatedAt, &record.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	record.StatusCode = int(status.Int64)
+	if header != nil {
+		if err := json.Unmarshal(header, &record.Header); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// Complete stores the response of a reserved key.
+func (r *IdempotencyRepository) Complete(ctx context.Context, scope, key string, status int, header map[string][]string, body []byte) error {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		"UPDATE idempotency_keys SET status_code=$1, response_headers=$2, response_body=$3 WHERE scope=$4 AND idempotency_key=$5",
+		status, headerJSON, body, scope, key,
+	)
+	return err
+}
+
+// Release deletes the reservation of a key whose request did not produce a response worth replaying.
+func (r *IdempotencyRepository) Release(ctx context.Context, scope, key string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE scope=$1 AND idempotency_key=$2 AND status_code IS NULL", scope, key)
+	return err
+}
+
+// DeleteExpired removes the records that expired before now and returns how many were removed.
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return execCount(ctx, r.db, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now)
+}
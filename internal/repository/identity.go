@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// IdentityStore stores the external identities linked to users, one user per subject
+// at a provider, and the secrets of pending OIDC logins, which can be consumed once.
+type IdentityStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) IdentityStore
+	CreateIdentity(ctx context.Context, identity *model.UserIdentity) (*model.UserIdentity, error)
+	GetIdentity(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+	CreateLoginState(ctx context.Context, state *model.OIDCLoginState) error
+	ConsumeLoginState(ctx context.Context, state string) (*model.OIDCLoginState, error)
+	DeleteExpiredLoginStates(ctx context.Context, now time.Time) (int64, error)
+}
+
+type IdentityRepository struct {
+	db Querier
+}
+
+func NewIdentityRepository(db Querier) *IdentityRepository {
+	return &IdentityRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *IdentityRepository) WithTx(tx *sql.Tx) IdentityStore {
+	return &IdentityRepository{db: tx}
+}
+
+// CreateIdentity links an external identity to a user.
+func (r *IdentityRepository) CreateIdentity(ctx context.Context, identity *model.UserIdentity) (*model.UserIdentity, error) {
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+			identity.UserID, identity.Provider, identity.Subject, identity.Email,
+		).Scan(&identity.ID, &identity.CreatedAt)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionIdentityLink, "user", identity.UserID)
+		event.ActorID = identity.UserID
+		event.Metadata = map[string]any{"provider": identity.Provider, "subject": identity.Subject}
+		return appendAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// GetIdentity retrieves the identity with the given subject at a provider.
+func (r *IdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	i := &model.UserIdentity{}
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider=$1 AND subject=$2",
+		provider, subject,
+	).Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// CreateLoginState stores the secrets of a pending OIDC login.
+func (r *IdentityRepository) CreateLoginState(ctx context.Context, state *model.OIDCLoginState) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO oidc_login_states (state, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)",
+		state.State, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt,
+	)
+	return err
+}
+
+// DeleteExpiredLoginStates removes the pending logins that expired before now and returns how many were removed.
+func (r *IdentityRepository) DeleteExpiredLoginStates(ctx context.Context, now time.Time) (int64, error) {
+	return execCount(ctx, r.db, "DELETE FROM oidc_login_states WHERE expires_at <= $1", now)
+}
+
+// ConsumeLoginState deletes and returns a pending OIDC login, so each state can be used only once.
+func (r *IdentityRepository) ConsumeLoginState(ctx context.Context, state string) (*model.OIDCLoginState, error) {
+	s := &model.OIDCLoginState{}
+	err := r.db.QueryRowContext(ctx,
+		"DELETE FROM oidc_login_states WHERE state=$1 RETURNING state, provider, code_verifier, nonce, expires_at", state,
+	).Scan(&s.State, &s.Provider, &s.CodeVerifier, &s.Nonce, &s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type APIKeyStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewAPIKeyStore(db *DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+func (s *APIKeyStore) WithTx(*sql.Tx) repository.APIKeyStore {
+	return &APIKeyStore{db: s.db, tx: true}
+}
+
+func (s *APIKeyStore) CreateKey(ctx context.Context, key *model.APIKey) (*model.APIKey, error) {
+	t, now := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.requireUser("api_keys", key.UserID); err != nil {
+		return nil, err
+	}
+	for _, other := range t.apiKeys {
+		if other.KeyHash == key.KeyHash {
+			return nil, uniqueViolation("api_keys", "api_keys_key_hash_key")
+		}
+	}
+	key.ID = newID()
+	key.CreatedAt = now
+	row := *key
+	row.Scopes = slices.Clone(key.Scopes)
+	t.apiKeys[key.ID] = row
+	return key, nil
+}
+
+func (s *APIKeyStore) GetKeyByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	for _, row := range t.apiKeys {
+		if row.KeyHash == keyHash {
+			row.Scopes = slices.Clone(row.Scopes)
+			return &row, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *APIKeyStore) ListKeys(ctx context.Context, userID string) ([]*model.APIKey, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var keys []*model.APIKey
+	for _, row := range t.apiKeys {
+		if row.UserID == userID && row.RevokedAt == nil {
+			row.Scopes = slices.Clone(row.Scopes)
+			keys = append(keys, &row)
+		}
+	}
+	slices.SortFunc(keys, func(a, b *model.APIKey) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return keys, nil
+}
+
+func (s *APIKeyStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if row, ok := t.apiKeys[id]; ok {
+		row.LastUsedAt = &usedAt
+		t.apiKeys[id] = row
+	}
+	return nil
+}
+
+func (s *APIKeyStore) RevokeKey(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.apiKeys[id]
+	if !ok || row.UserID != userID || row.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	row.RevokedAt = &revokedAt
+	t.apiKeys[id] = row
+	return nil
+}
+
+func (s *APIKeyStore) RevokeAllKeys(ctx context.Context, userID string, revokedAt time.Time) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var n int64
+	for id, row := range t.apiKeys {
+		if row.UserID == userID && row.RevokedAt == nil {
+			row.RevokedAt = &revokedAt
+			t.apiKeys[id] = row
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+// AuditStore keeps the events passed to CreateEvent. It does not hash them, so
+// VerifyChain always reports a valid chain.
+type AuditStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewAuditStore(db *DB) *AuditStore {
+	return &AuditStore{db: db}
+}
+
+func (s *AuditStore) WithTx(*sql.Tx) repository.AuditStore {
+	return &AuditStore{db: s.db, tx: true}
+}
+
+func (s *AuditStore) CreateEvent(ctx context.Context, event *model.AuditEvent) error {
+	t, now := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	event.ID = int64(len(t.auditEvents)) + 1
+	event.CreatedAt = now
+	t.auditEvents = append(t.auditEvents, *event)
+	return nil
+}
+
+// ListEvents returns the events matching the filter, newest first.
+func (s *AuditStore) ListEvents(ctx context.Context, f *model.AuditFilter) ([]*model.AuditEvent, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var events []*model.AuditEvent
+	skipped := 0
+	for i := len(t.auditEvents) - 1; i >= 0 && len(events) < f.Limit; i-- {
+		e := t.auditEvents[i]
+		if !matches(&e, f) {
+			continue
+		}
+		if skipped < f.Offset {
+			skipped++
+			continue
+		}
+		events = append(events, &e)
+	}
+	return events, nil
+}
+
+func (s *AuditStore) VerifyChain(ctx context.Context) (*model.AuditChainReport, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	return &model.AuditChainReport{Valid: true, Count: int64(len(t.auditEvents))}, nil
+}
+
+func matches(e *model.AuditEvent, f *model.AuditFilter) bool {
+	return (f.ActorID == "" || e.ActorID == f.ActorID) &&
+		(f.ImpersonatorID == "" || e.ImpersonatorID == f.ImpersonatorID) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.TargetType == "" || e.TargetType == f.TargetType) &&
+		(f.TargetID == "" || e.TargetID == f.TargetID) &&
+		(f.RequestID == "" || e.RequestID == f.RequestID) &&
+		(f.From == nil || !e.CreatedAt.Before(*f.From)) &&
+		(f.To == nil || e.CreatedAt.Before(*f.To))
+}
@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type PasswordResetStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewPasswordResetStore(db *DB) *PasswordResetStore {
+	return &PasswordResetStore{db: db}
+}
+
+func (s *PasswordResetStore) WithTx(*sql.Tx) repository.PasswordResetStore {
+	return &PasswordResetStore{db: s.db, tx: true}
+}
+
+func (s *PasswordResetStore) CreateToken(ctx context.Context, tokenHash, userID string, expiresAt time.Time) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.requireUser("password_reset_tokens", userID); err != nil {
+		return err
+	}
+	if _, ok := t.resetTokens[tokenHash]; ok {
+		return uniqueViolation("password_reset_tokens", "password_reset_tokens_pkey")
+	}
+	t.resetTokens[tokenHash] = model.PasswordResetToken{TokenHash: tokenHash, UserID: userID, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (s *PasswordResetStore) GetToken(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.resetTokens[tokenHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &row, nil
+}
+
+func (s *PasswordResetStore) DeleteToken(ctx context.Context, tokenHash string) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if _, ok := t.resetTokens[tokenHash]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(t.resetTokens, tokenHash)
+	return nil
+}
+
+func (s *PasswordResetStore) DeleteUserTokens(ctx context.Context, userID string) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	before := len(t.resetTokens)
+	maps.DeleteFunc(t.resetTokens, func(_ string, r model.PasswordResetToken) bool { return r.UserID == userID })
+	return int64(before - len(t.resetTokens)), nil
+}
+
+func (s *PasswordResetStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	before := len(t.resetTokens)
+	maps.DeleteFunc(t.resetTokens, func(_ string, r model.PasswordResetToken) bool { return !r.ExpiresAt.After(now) })
+	return int64(before - len(t.resetTokens)), nil
+}
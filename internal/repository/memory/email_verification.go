@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type EmailVerificationStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewEmailVerificationStore(db *DB) *EmailVerificationStore {
+	return &EmailVerificationStore{db: db}
+}
+
+func (s *EmailVerificationStore) WithTx(*sql.Tx) repository.EmailVerificationStore {
+	return &EmailVerificationStore{db: s.db, tx: true}
+}
+
+// CreateToken stores a token, replacing any pending one of the user.
+func (s *EmailVerificationStore) CreateToken(ctx context.Context, token *model.EmailVerificationToken) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.requireUser("email_verification_tokens", token.UserID); err != nil {
+		return err
+	}
+	maps.DeleteFunc(t.emailTokens, func(_ string, r model.EmailVerificationToken) bool { return r.UserID == token.UserID })
+	if _, ok := t.emailTokens[token.TokenHash]; ok {
+		return uniqueViolation("email_verification_tokens", "email_verification_tokens_pkey")
+	}
+	t.emailTokens[token.TokenHash] = *token
+	return nil
+}
+
+func (s *EmailVerificationStore) ConsumeToken(ctx context.Context, tokenHash string) (*model.EmailVerificationToken, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.emailTokens[tokenHash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(t.emailTokens, tokenHash)
+	return &row, nil
+}
+
+func (s *EmailVerificationStore) DeleteUserTokens(ctx context.Context, userID string) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	before := len(t.emailTokens)
+	maps.DeleteFunc(t.emailTokens, func(_ string, r model.EmailVerificationToken) bool { return r.UserID == userID })
+	return int64(before - len(t.emailTokens)), nil
+}
+
+func (s *EmailVerificationStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	before := len(t.emailTokens)
+	maps.DeleteFunc(t.emailTokens, func(_ string, r model.EmailVerificationToken) bool { return !r.ExpiresAt.After(now) })
+	return int64(before - len(t.emailTokens)), nil
+}
@@ -0,0 +1,28 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+// HealthStore reports a reachable database at the schema version the code expects,
+// unless PingErr is set.
+type HealthStore struct {
+	PingErr error
+}
+
+func NewHealthStore() *HealthStore {
+	return &HealthStore{}
+}
+
+func (s *HealthStore) Ping(ctx context.Context) error {
+	return s.PingErr
+}
+
+func (s *HealthStore) AppliedSchemaVersion(ctx context.Context) (int, error) {
+	if s.PingErr != nil {
+		return 0, s.PingErr
+	}
+	return repository.SchemaVersion, nil
+}
@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type IdempotencyStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewIdempotencyStore(db *DB) *IdempotencyStore {
+	return &IdempotencyStore{db: db}
+}
+
+func (s *IdempotencyStore) WithTx(*sql.Tx) repository.IdempotencyStore {
+	return &IdempotencyStore{db: s.db, tx: true}
+}
+
+// Reserve claims the key of record unless an unexpired record holds it.
+func (s *IdempotencyStore) Reserve(ctx context.Context, record *model.IdempotencyRecord) (bool, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	k := idempotencyKey{record.Scope, record.Key}
+	if existing, ok := t.idempotency[k]; ok && existing.ExpiresAt.After(record.CreatedAt) {
+		return false, nil
+	}
+	t.idempotency[k] = model.IdempotencyRecord{
+		Scope:       record.Scope,
+		Key:         record.Key,
+		RequestHash: record.RequestHash,
+		CreatedAt:   record.CreatedAt,
+		ExpiresAt:   record.ExpiresAt,
+	}
+	return true, nil
+}
+
+func (s *IdempotencyStore) GetRecord(ctx context.Context, scope, key string) (*model.IdempotencyRecord, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.idempotency[idempotencyKey{scope, key}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	row.Header = maps.Clone(row.Header)
+	row.Body = slices.Clone(row.Body)
+	return &row, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, scope, key string, status int, header map[string][]string, body []byte) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	k := idempotencyKey{scope, key}
+	if row, ok := t.idempotency[k]; ok {
+		row.StatusCode = status
+		row.Header = maps.Clone(header)
+		row.Body = slices.Clone(body)
+		t.idempotency[k] = row
+	}
+	return nil
+}
+
+// Release deletes the reservation of a key that has no stored response.
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	k := idempotencyKey{scope, key}
+	if row, ok := t.idempotency[k]; ok && row.StatusCode == 0 {
+		delete(t.idempotency, k)
+	}
+	return nil
+}
+
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	before := len(t.idempotency)
+	maps.DeleteFunc(t.idempotency, func(_ idempotencyKey, r model.IdempotencyRecord) bool { return !r.ExpiresAt.After(now) })
+	return int64(before - len(t.idempotency)), nil
+}
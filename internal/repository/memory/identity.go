@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type IdentityStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewIdentityStore(db *DB) *IdentityStore {
+	return &IdentityStore{db: db}
+}
+
+func (s *IdentityStore) WithTx(*sql.Tx) repository.IdentityStore {
+	return &IdentityStore{db: s.db, tx: true}
+}
+
+func (s *IdentityStore) CreateIdentity(ctx context.Context, identity *model.UserIdentity) (*model.UserIdentity, error) {
+	t, now := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.requireUser("user_identities", identity.UserID); err != nil {
+		return nil, err
+	}
+	for _, other := range t.identities {
+		if other.Provider == identity.Provider && other.Subject == identity.Subject {
+			return nil, uniqueViolation("user_identities", "uq_user_identities_provider_subject")
+		}
+	}
+	identity.ID = newID()
+	identity.CreatedAt = now
+	t.identities[identity.ID] = *identity
+	return identity, nil
+}
+
+func (s *IdentityStore) GetIdentity(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	for _, row := range t.identities {
+		if row.Provider == provider && row.Subject == subject {
+			return &row, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *IdentityStore) CreateLoginState(ctx context.Context, state *model.OIDCLoginState) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if _, ok := t.loginStates[state.State]; ok {
+		return uniqueViolation("oidc_login_states", "oidc_login_states_pkey")
+	}
+	t.loginStates[state.State] = *state
+	return nil
+}
+
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, state string) (*model.OIDCLoginState, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.loginStates[state]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(t.loginStates, state)
+	return &row, nil
+}
+
+func (s *IdentityStore) DeleteExpiredLoginStates(ctx context.Context, now time.Time) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	before := len(t.loginStates)
+	maps.DeleteFunc(t.loginStates, func(_ string, r model.OIDCLoginState) bool { return !r.ExpiresAt.After(now) })
+	return int64(before - len(t.loginStates)), nil
+}
@@ -0,0 +1,175 @@
+// Package memory implements the repository stores in memory, for unit tests of the
+// services. The stores share one DB so that, like PostgreSQL, they enforce unique
+// emails and foreign keys to users, cascade the deletion of a user, and roll back a
+// failed transaction. Constraint violations are returned as *pq.Error with the codes
+// PostgreSQL uses, so services translate them as they do in production.
+//
+// Unlike the PostgreSQL repositories, the stores do not write audit events for the
+// changes they make.
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// DB holds the tables of every store. It is safe for concurrent use.
+type DB struct {
+	// txMu is held for the whole of a transaction and by every statement outside one,
+	// so a rollback only undoes the changes of its own transaction.
+	txMu sync.Mutex
+	mu   sync.Mutex
+	t    tables
+	// Now returns the current time, for timestamps the database would fill in.
+	Now func() time.Time
+}
+
+type tables struct {
+	users           map[string]model.User
+	passwordHistory []historyEntry
+	resetTokens     map[string]model.PasswordResetToken
+	sessions        map[string]model.Session
+	apiKeys         map[string]model.APIKey
+	identities      map[string]model.UserIdentity
+	loginStates     map[string]model.OIDCLoginState
+	emailTokens     map[string]model.EmailVerificationToken
+	idempotency     map[idempotencyKey]model.IdempotencyRecord
+	auditEvents     []model.AuditEvent
+}
+
+type historyEntry struct {
+	userID string
+	hash   string
+}
+
+type idempotencyKey struct {
+	scope, key string
+}
+
+func NewDB() *DB {
+	return &DB{
+		t: tables{
+			users:       map[string]model.User{},
+			resetTokens: map[string]model.PasswordResetToken{},
+			sessions:    map[string]model.Session{},
+			apiKeys:     map[string]model.APIKey{},
+			identities:  map[string]model.UserIdentity{},
+			loginStates: map[string]model.OIDCLoginState{},
+			emailTokens: map[string]model.EmailVerificationToken{},
+			idempotency: map[idempotencyKey]model.IdempotencyRecord{},
+		},
+		Now: time.Now,
+	}
+}
+
+// clone copies the tables. Rows are stored by value, so copying the maps is enough.
+func (t *tables) clone() tables {
+	return tables{
+		users:           maps.Clone(t.users),
+		passwordHistory: slices.Clone(t.passwordHistory),
+		resetTokens:     maps.Clone(t.resetTokens),
+		sessions:        maps.Clone(t.sessions),
+		apiKeys:         maps.Clone(t.apiKeys),
+		identities:      maps.Clone(t.identities),
+		loginStates:     maps.Clone(t.loginStates),
+		emailTokens:     maps.Clone(t.emailTokens),
+		idempotency:     maps.Clone(t.idempotency),
+		auditEvents:     slices.Clone(t.auditEvents),
+	}
+}
+
+// WithinTx implements repository.Transactor. fn is passed a nil *sql.Tx; the stores
+// its WithTx calls return run inside the transaction, and every change they make is
+// undone if fn returns an error or panics. Stores used directly wait until the
+// transaction ends, so fn must not use them.
+func (db *DB) WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+	db.mu.Lock()
+	snapshot := db.t.clone()
+	db.mu.Unlock()
+
+	rollback := func() {
+		db.mu.Lock()
+		db.t = snapshot
+		db.mu.Unlock()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(nil); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// lock locks the tables and returns them with the current time. Unless inTx is set,
+// it first waits for the running transaction to end.
+func (db *DB) lock(inTx bool) (*tables, time.Time) {
+	if !inTx {
+		db.txMu.Lock()
+	}
+	db.mu.Lock()
+	return &db.t, db.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (db *DB) unlock(inTx bool) {
+	db.mu.Unlock()
+	if !inTx {
+		db.txMu.Unlock()
+	}
+}
+
+// requireUser returns the foreign key violation PostgreSQL reports when a row refers
+// to a user that does not exist.
+func (t *tables) requireUser(table, userID string) error {
+	if _, ok := t.users[userID]; !ok {
+		return &pq.Error{
+			Code:       "23503",
+			Message:    fmt.Sprintf(`insert or update on table %q violates foreign key constraint "%s_user_id_fkey"`, table, table),
+			Table:      table,
+			Constraint: table + "_user_id_fkey",
+		}
+	}
+	return nil
+}
+
+func uniqueViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+func checkViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       "23514",
+		Message:    fmt.Sprintf("new row for relation %q violates check constraint %q", table, constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+// newID returns a random UUID, as uuid_generate_v4() does.
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
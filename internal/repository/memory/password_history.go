@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type PasswordHistoryStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewPasswordHistoryStore(db *DB) *PasswordHistoryStore {
+	return &PasswordHistoryStore{db: db}
+}
+
+func (s *PasswordHistoryStore) WithTx(*sql.Tx) repository.PasswordHistoryStore {
+	return &PasswordHistoryStore{db: s.db, tx: true}
+}
+
+func (s *PasswordHistoryStore) AddPasswordHash(ctx context.Context, userID, hash string, keep int) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.requireUser("password_history", userID); err != nil {
+		return err
+	}
+	t.passwordHistory = append(t.passwordHistory, historyEntry{userID: userID, hash: hash})
+	// Drop all but the keep most recent entries of the user, scanning from the newest
+	kept := 0
+	for i := len(t.passwordHistory) - 1; i >= 0; i-- {
+		if t.passwordHistory[i].userID != userID {
+			continue
+		}
+		if kept++; kept > keep {
+			t.passwordHistory = append(t.passwordHistory[:i], t.passwordHistory[i+1:]...)
+		}
+	}
+	return nil
+}
+
+// ListRecentHashes returns the limit most recent hashes of a user, newest first.
+func (s *PasswordHistoryStore) ListRecentHashes(ctx context.Context, userID string, limit int) ([]string, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var hashes []string
+	for i := len(t.passwordHistory) - 1; i >= 0 && len(hashes) < limit; i-- {
+		if e := t.passwordHistory[i]; e.userID == userID {
+			hashes = append(hashes, e.hash)
+		}
+	}
+	return hashes, nil
+}
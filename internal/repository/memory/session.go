@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+type SessionStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewSessionStore(db *DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+func (s *SessionStore) WithTx(*sql.Tx) repository.SessionStore {
+	return &SessionStore{db: s.db, tx: true}
+}
+
+func (s *SessionStore) CreateSession(ctx context.Context, session *model.Session) (*model.Session, error) {
+	t, now := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.requireUser("user_sessions", session.UserID); err != nil {
+		return nil, err
+	}
+	session.ID = newID()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	t.sessions[session.ID] = *session
+	return session, nil
+}
+
+func (s *SessionStore) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &row, nil
+}
+
+func (s *SessionStore) ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]*model.Session, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var sessions []*model.Session
+	for _, row := range t.sessions {
+		if row.UserID == userID && row.RevokedAt == nil && row.ExpiresAt.After(now) {
+			sessions = append(sessions, &row)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b *model.Session) int { return b.LastSeenAt.Compare(a.LastSeenAt) })
+	return sessions, nil
+}
+
+func (s *SessionStore) TouchSession(ctx context.Context, id string, seenAt time.Time) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if row, ok := t.sessions[id]; ok {
+		row.LastSeenAt = seenAt
+		t.sessions[id] = row
+	}
+	return nil
+}
+
+func (s *SessionStore) RevokeSession(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.sessions[id]
+	if !ok || row.UserID != userID || row.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	row.RevokedAt = &revokedAt
+	t.sessions[id] = row
+	return nil
+}
+
+func (s *SessionStore) RevokeAllSessions(ctx context.Context, userID, keepID string, revokedAt time.Time) (int64, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var n int64
+	for id, row := range t.sessions {
+		if row.UserID == userID && row.RevokedAt == nil && id != keepID {
+			row.RevokedAt = &revokedAt
+			t.sessions[id] = row
+			n++
+		}
+	}
+	return n, nil
+}
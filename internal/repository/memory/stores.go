@@ -0,0 +1,18 @@
+package memory
+
+import "github.com/minab/internship-backend/internal/repository"
+
+// Compile-time checks that the fakes implement the store interfaces.
+var (
+	_ repository.Transactor             = (*DB)(nil)
+	_ repository.UserStore              = (*UserStore)(nil)
+	_ repository.PasswordHistoryStore   = (*PasswordHistoryStore)(nil)
+	_ repository.PasswordResetStore     = (*PasswordResetStore)(nil)
+	_ repository.SessionStore           = (*SessionStore)(nil)
+	_ repository.APIKeyStore            = (*APIKeyStore)(nil)
+	_ repository.IdentityStore          = (*IdentityStore)(nil)
+	_ repository.EmailVerificationStore = (*EmailVerificationStore)(nil)
+	_ repository.IdempotencyStore       = (*IdempotencyStore)(nil)
+	_ repository.AuditStore             = (*AuditStore)(nil)
+	_ repository.HealthStore            = (*HealthStore)(nil)
+)
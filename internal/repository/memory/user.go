@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+// phonePattern mirrors the chk_phone_format constraint of the users table.
+var phonePattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+type UserStore struct {
+	db *DB
+	// tx is set on the stores WithTx returns, which run inside the transaction.
+	tx bool
+}
+
+func NewUserStore(db *DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+func (s *UserStore) WithTx(*sql.Tx) repository.UserStore {
+	return &UserStore{db: s.db, tx: true}
+}
+
+// GetUserByID returns the user without their password hash, like the SQL query.
+func (s *UserStore) GetUserByID(ctx context.Context, id string) (*model.User, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	u, ok := t.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	u.Password = ""
+	return &u, nil
+}
+
+func (s *UserStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	for _, u := range t.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// ListUsers returns every user without their password hash, oldest first.
+func (s *UserStore) ListUsers(ctx context.Context) ([]*model.User, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	var users []*model.User
+	for _, u := range t.users {
+		u.Password = ""
+		users = append(users, &u)
+	}
+	slices.SortFunc(users, func(a, b *model.User) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return users, nil
+}
+
+func (s *UserStore) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
+	t, now := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if err := t.checkUser(*user, ""); err != nil {
+		return nil, err
+	}
+	user.ID = newID()
+	user.CreatedAt = now
+	user.Version = 1
+	t.users[user.ID] = *user
+	return user, nil
+}
+
+// UpdateUser updates the profile fields of a user, checking the version like the
+// PostgreSQL repository.
+func (s *UserStore) UpdateUser(ctx context.Context, id string, user *model.User, expectedVersion int64) (*model.User, error) {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if expectedVersion != repository.AnyVersion && row.Version != expectedVersion {
+		return nil, repository.ErrVersionConflict
+	}
+	row.FullName = user.FullName
+	row.PhoneNumber = user.PhoneNumber
+	if user.Role != "" {
+		row.Role = user.Role
+	}
+	row.Version++
+	if err := t.checkUser(row, id); err != nil {
+		return nil, err
+	}
+	t.users[id] = row
+	*user = row
+	user.Password = ""
+	return user, nil
+}
+
+// DeleteUser deletes a user and, as the foreign keys cascade, every row that refers to them.
+func (s *UserStore) DeleteUser(ctx context.Context, id string) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	if _, ok := t.users[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(t.users, id)
+	t.passwordHistory = slices.DeleteFunc(t.passwordHistory, func(e historyEntry) bool { return e.userID == id })
+	maps.DeleteFunc(t.resetTokens, func(_ string, r model.PasswordResetToken) bool { return r.UserID == id })
+	maps.DeleteFunc(t.sessions, func(_ string, r model.Session) bool { return r.UserID == id })
+	maps.DeleteFunc(t.apiKeys, func(_ string, r model.APIKey) bool { return r.UserID == id })
+	maps.DeleteFunc(t.identities, func(_ string, r model.UserIdentity) bool { return r.UserID == id })
+	maps.DeleteFunc(t.emailTokens, func(_ string, r model.EmailVerificationToken) bool { return r.UserID == id })
+	return nil
+}
+
+func (s *UserStore) UpdateEmail(ctx context.Context, id, email string) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	row.Email = email
+	row.Version++
+	if err := t.checkUser(row, id); err != nil {
+		return err
+	}
+	t.users[id] = row
+	return nil
+}
+
+// UpdatePassword replaces only the password hash, leaving the version unchanged.
+func (s *UserStore) UpdatePassword(ctx context.Context, id, hash string) error {
+	t, _ := s.db.lock(s.tx)
+	defer s.db.unlock(s.tx)
+	row, ok := t.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	row.Password = hash
+	t.users[id] = row
+	return nil
+}
+
+func (s *UserStore) RehashPassword(ctx context.Context, id, hash string) error {
+	return s.UpdatePassword(ctx, id, hash)
+}
+
+// checkUser enforces the constraints of the users table on u, which is stored under
+// id ("" for a new user).
+func (t *tables) checkUser(u model.User, id string) error {
+	if !model.IsValidRole(u.Role) {
+		return checkViolation("users", "chk_role")
+	}
+	if u.PhoneNumber != "" && !phonePattern.MatchString(u.PhoneNumber) {
+		return checkViolation("users", "chk_phone_format")
+	}
+	for otherID, other := range t.users {
+		if otherID != id && other.Email == u.Email {
+			return uniqueViolation("users", "users_email_key")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// PasswordHistoryStore stores the most recent password hashes of each user, so that
+// old passwords cannot be reused.
+type PasswordHistoryStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) PasswordHistoryStore
+	AddPasswordHash(ctx context.Context, userID, hash string, keep int) error
+	ListRecentHashes(ctx context.Context, userID string, limit int) ([]string, error)
+}
+
+type PasswordHistoryRepository struct {
+	db Querier
+}
+
+func NewPasswordHistoryRepository(db Querier) *PasswordHistoryRepository {
+	return &PasswordHistoryRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *PasswordHistoryRepository) WithTx(tx *sql.Tx) PasswordHistoryStore {
+	return &PasswordHistoryRepository{db: tx}
+}
+
+// AddPasswordHash records a password hash for a user and prunes all but the keep most recent entries.
+func (r *PasswordHistoryRepository) AddPasswordHash(ctx context.Context, userID, hash string, keep int) error {
+	if _, err := r.db.ExecContext(ctx, "INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)", userID, hash); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx,
+		"DELETE FROM password_history WHERE user_id=$1 AND id NOT IN (SELECT id FROM password_history WHERE user_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2)",
+		userID, keep,
+	)
+	return err
+}
+
+// ListRecentHashes retrieves the limit most recent password hashes of a user.
+func (r *PasswordHistoryRepository) ListRecentHashes(ctx context.Context, userID string, limit int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT password_hash FROM password_history WHERE user_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2",
+		userID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
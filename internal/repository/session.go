@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// SessionStore stores login sessions. Sessions are revoked rather than deleted, so
+// GetSession also returns revoked and expired ones.
+type SessionStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) SessionStore
+	CreateSession(ctx context.Context, session *model.Session) (*model.Session, error)
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+	ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]*model.Session, error)
+	TouchSession(ctx context.Context, id string, seenAt time.Time) error
+	RevokeSession(ctx context.Context, userID, id string, revokedAt time.Time) error
+	RevokeAllSessions(ctx context.Context, userID, keepID string, revokedAt time.Time) (int64, error)
+}
+
+type SessionRepository struct {
+	db Querier
+}
+
+func NewSessionRepository(db Querier) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs its statements in tx.
+func (r *SessionRepository) WithTx(tx *sql.Tx) SessionStore {
+	return &SessionRepository{db: tx}
+}
+
+// CreateSession inserts a new session and fills in its ID and timestamps.
+func (r *SessionRepository) CreateSession(ctx context.Context, session *model.Session) (*model.Session, error) {
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO user_sessions (user_id, user_agent, ip_address, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at, last_seen_at",
+			session.UserID, session.UserAgent, session.IPAddress, session.ExpiresAt,
+		).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionSessionCreate, "session", session.ID)
+		// Sessions are created at login, before the user has any claims.
+		event.ActorID = session.UserID
+		event.Metadata = map[string]any{"user_id": session.UserID, "user_agent": session.UserAgent}
+		return appendAuditEvent(ctx, tx, event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSession retrieves a session by its ID, including revoked and expired ones.
+func (r *SessionRepository) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	s := &model.Session{}
+	err := r.db.QueryRowContext(ctx,
+		"SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at FROM user_sessions WHERE id=$1", id,
+	).Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListActiveSessions retrieves the sessions of a user that are neither revoked nor expired, most recently used first.
+func (r *SessionRepository) ListActiveSessions(ctx context.Context, userID string, now time.Time) ([]*model.Session, error) {
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at, revoked_at FROM user_sessions WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC",
+		userID, now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*model.Session
+	for rows.Next() {
+		s := &model.Session{}
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession updates the last-seen timestamp of a session.
+func (r *SessionRepository) TouchSession(ctx context.Context, id string, seenAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE user_sessions SET last_seen_at=$1 WHERE id=$2", seenAt, id)
+	return err
+}
+
+// RevokeSession marks a single session of a user as revoked. It returns sql.ErrNoRows
+// if the user has no active session with that ID.
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID, id string, revokedAt time.Time) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE user_sessions SET revoked_at=$1 WHERE id=$2 AND user_id=$3 AND revoked_at IS NULL",
+			revokedAt, id, userID,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		event := auditEvent(ctx, model.AuditActionSessionRevoke, "session", id)
+		event.Metadata = map[string]any{"user_id": userID}
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// RevokeAllSessions marks every active session of a user as revoked, except the one
+// with ID keepID (pass "" to revoke all). It returns the number of revoked sessions.
+func (r *SessionRepository) RevokeAllSessions(ctx context.Context, userID, keepID string, revokedAt time.Time) (int64, error) {
+	var n int64
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE user_sessions SET revoked_at=$1 WHERE user_id=$2 AND revoked_at IS NULL AND id::text <> $3",
+			revokedAt, userID, keepID,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err = res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionSessionRevokeAll, "user", userID)
+		event.Metadata = map[string]any{"revoked": n, "kept_session_id": keepID}
+		return appendAuditEvent(ctx, tx, event)
+	})
+	return n, err
+}
@@ -0,0 +1,107 @@
+// Package repository stores the application's data in PostgreSQL.
+//
+// Each XRepository implements an XStore interface, and the services depend only on
+// the interfaces so that their unit tests can run against the in-memory fakes in
+// repository/memory. Stores return sql.ErrNoRows for a missing row and the *pq.Error
+// of PostgreSQL for a violated constraint. Their WithTx method returns a store that
+// runs its statements in a transaction started by a Transactor.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Querier runs statements. It is implemented by *sql.DB and *sql.Tx, so repositories
+// run the same code outside and inside a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// maxTxAttempts is how many times a transaction is run before a serialization
+// failure or deadlock is returned to the caller.
+const maxTxAttempts = 3
+
+// Transactor runs units of work in a transaction: the writes fn makes through stores
+// passed tx are committed together if fn returns nil and rolled back otherwise.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error
+}
+
+// TxManager runs units of work that span several repository calls in one transaction.
+type TxManager struct {
+	db *sql.DB
+}
+
+func NewTxManager(db *sql.DB) *TxManager {
+	return &TxManager{db: db}
+}
+
+// WithinTx runs fn in a transaction, committing if it returns nil and rolling back if it
+// returns an error or panics. Repositories join the transaction through their WithTx
+// method. As the transaction is retried from the start on a serialization failure or
+// deadlock, fn must not have effects outside the database.
+func (m *TxManager) WithinTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return withinTx(ctx, m.db, fn)
+}
+
+func withinTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	backoff := 10 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, fn)
+		if err == nil || attempt == maxTxAttempts || !isRetryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func runTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// inTx runs fn in the transaction q if it is one, so repository methods that need a
+// transaction of their own join the caller's unit of work, and in a new one otherwise.
+func inTx(ctx context.Context, q Querier, fn func(tx *sql.Tx) error) error {
+	switch q := q.(type) {
+	case *sql.Tx:
+		return fn(q)
+	case *sql.DB:
+		return withinTx(ctx, q, fn)
+	default:
+		return fmt.Errorf("repository: cannot start a transaction on %T", q)
+	}
+}
+
+// isRetryable reports whether err is a PostgreSQL serialization failure or deadlock,
+// after which the whole transaction can be run again.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
@@ -7,19 +7,44 @@ import (
 	"github.com/minab/internship-backend/internal/model"
 )
 
+// UserStore stores users. Emails are unique, profile updates increment the version of
+// the user, and creating, updating and deleting a user is recorded in the audit log.
+type UserStore interface {
+	// WithTx returns a store that runs its statements in tx.
+	WithTx(tx *sql.Tx) UserStore
+	GetUserByID(ctx context.Context, id string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	ListUsers(ctx context.Context) ([]*model.User, error)
+	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
+	UpdateUser(ctx context.Context, id string, user *model.User, expectedVersion int64) (*model.User, error)
+	DeleteUser(ctx context.Context, id string) error
+	UpdateEmail(ctx context.Context, id, email string) error
+	UpdatePassword(ctx context.Context, id, hash string) error
+	RehashPassword(ctx context.Context, id, hash string) error
+}
+
+// UserRepository writes to db and serves ListUsers from replica, which may be db itself
+// when there is no read replica. Every other read goes to db: its callers make
+// authorization decisions or base updates on the result, which must not lag behind.
 type UserRepository struct {
-	db *sql.DB
+	db      Querier
+	replica Querier
+}
+
+func NewUserRepository(db, replica Querier) *UserRepository {
+	return &UserRepository{db: db, replica: replica}
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+// WithTx returns a copy of the repository that runs its statements, reads included, in tx.
+func (r *UserRepository) WithTx(tx *sql.Tx) UserStore {
+	return &UserRepository{db: tx, replica: tx}
 }
 
-// GetUserByID retrieves a user by their ID from the database.
+// GetUserByID retrieves a user by their ID.
 func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*model.User, error) {
 	user := &model.User{}
-	err := r.db.QueryRowContext(ctx, "SELECT id, full_name, email, phone_number, role, created_at FROM users WHERE id=$1", id).
-		Scan(&user.ID, &user.FullName, &user.Email, &user.PhoneNumber, &user.Role, &user.CreatedAt)
+	err := r.db.QueryRowContext(ctx, "SELECT id, full_name, email, phone_number, role, is_service_account, created_at, version FROM users WHERE id=$1", id).
+		Scan(&user.ID, &user.FullName, &user.Email, &user.PhoneNumber, &user.Role, &user.IsServiceAccount, &user.CreatedAt, &user.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -27,32 +52,144 @@ func (r *UserRepository) GetUserByID(ctx context.Context, id string) (*model.Use
 }
 
 // CreateUser inserts a new user into the database and returns the created user with its ID and creation timestamp.
+// The creation is recorded in the audit log in the same transaction.
 func (r *UserRepository) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
-	err := r.db.QueryRowContext(ctx,
-		"INSERT INTO users (full_name, email, password, phone_number, role) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
-		user.FullName, user.Email, user.Password, user.PhoneNumber, user.Role,
-	).Scan(&user.ID, &user.CreatedAt)
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx,
+			"INSERT INTO users (full_name, email, password, phone_number, role, is_service_account) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, version",
+			user.FullName, user.Email, user.Password, user.PhoneNumber, user.Role, user.IsServiceAccount,
+		).Scan(&user.ID, &user.CreatedAt, &user.Version)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionUserCreate, "user", user.ID)
+		// Self-registration and social sign-up have no signed-in actor.
+		if event.ActorID == "" {
+			event.ActorID = user.ID
+		}
+		event.Changes = model.DiffFields(nil, user.AuditFields())
+		return appendAuditEvent(ctx, tx, event)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-// UpdateUser updates an existing user in the database and returns the updated user.
-func (r *UserRepository) UpdateUser(ctx context.Context, id string, user *model.User) (*model.User, error) {
-	err := r.db.QueryRowContext(ctx,
-		"UPDATE users SET full_name=$1, email=$2, password=$3, phone_number=$4, role=$5 WHERE id=$6 RETURNING id, full_name, email, password, phone_number, role, created_at",
-		user.FullName, user.Email, user.Password, user.PhoneNumber, user.Role, id,
-	).Scan(&user.ID, &user.FullName, &user.Email, &user.Password, &user.PhoneNumber, &user.Role, &user.CreatedAt)
+// UpdateUser updates an existing user's profile fields in the database and returns the updated user.
+// An empty Role keeps the current role. The email and password are changed separately through
+// UpdateEmail and UpdatePassword, and user.Email is ignored. The update fails with ErrVersionConflict
+// unless the user is still at expectedVersion (or AnyVersion is passed), and increments the version.
+// The changed fields are recorded in the audit log in the same transaction.
+func (r *UserRepository) UpdateUser(ctx context.Context, id string, user *model.User, expectedVersion int64) (*model.User, error) {
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		before := &model.User{}
+		err := tx.QueryRowContext(ctx, "SELECT id, full_name, email, phone_number, role, is_service_account, created_at, version FROM users WHERE id=$1 FOR UPDATE", id).
+			Scan(&before.ID, &before.FullName, &before.Email, &before.PhoneNumber, &before.Role, &before.IsServiceAccount, &before.CreatedAt, &before.Version)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(before.Version, expectedVersion); err != nil {
+			return err
+		}
+		err = tx.QueryRowContext(ctx,
+			"UPDATE users SET full_name=$1, phone_number=$2, role=COALESCE(NULLIF($3, ''), role), version=version+1, updated_at=CURRENT_TIMESTAMP WHERE id=$4 RETURNING id, full_name, email, phone_number, role, is_service_account, created_at, version",
+			user.FullName, user.PhoneNumber, user.Role, id,
+		).Scan(&user.ID, &user.FullName, &user.Email, &user.PhoneNumber, &user.Role, &user.IsServiceAccount, &user.CreatedAt, &user.Version)
+		if err != nil {
+			return err
+		}
+		changes := model.DiffFields(before.AuditFields(), user.AuditFields())
+		if len(changes) == 0 {
+			return nil
+		}
+		event := auditEvent(ctx, model.AuditActionUserUpdate, "user", id)
+		event.Changes = changes
+		return appendAuditEvent(ctx, tx, event)
+	})
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-// ListUsers retrieves all users from the database.
+// DeleteUser deletes a user together with their sessions, keys and other owned rows. It returns
+// sql.ErrNoRows if the user does not exist. The deleted fields are recorded in the audit log in
+// the same transaction.
+func (r *UserRepository) DeleteUser(ctx context.Context, id string) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		before := &model.User{}
+		err := tx.QueryRowContext(ctx, "DELETE FROM users WHERE id=$1 RETURNING id, full_name, email, phone_number, role, is_service_account, created_at, version", id).
+			Scan(&before.ID, &before.FullName, &before.Email, &before.PhoneNumber, &before.Role, &before.IsServiceAccount, &before.CreatedAt, &before.Version)
+		if err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionUserDelete, "user", id)
+		event.Changes = model.DiffFields(before.AuditFields(), nil)
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// UpdateEmail replaces the email of a user once the new address has been verified.
+// It returns sql.ErrNoRows if the user does not exist.
+func (r *UserRepository) UpdateEmail(ctx context.Context, id, email string) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		var before string
+		if err := tx.QueryRowContext(ctx, "SELECT email FROM users WHERE id=$1 FOR UPDATE", id).Scan(&before); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email=$1, version=version+1, updated_at=CURRENT_TIMESTAMP WHERE id=$2", email, id); err != nil {
+			return err
+		}
+		event := auditEvent(ctx, model.AuditActionUserUpdate, "user", id)
+		// Verification links are opened without a signed-in actor.
+		if event.ActorID == "" {
+			event.ActorID = id
+		}
+		event.Changes = map[string]model.FieldChange{"email": {Before: before, After: email}}
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// UpdatePassword replaces only the password hash of a user. It returns sql.ErrNoRows if the user does not exist.
+func (r *UserRepository) UpdatePassword(ctx context.Context, id, hash string) error {
+	return r.setPassword(ctx, id, hash, model.AuditActionPasswordChange)
+}
+
+// RehashPassword replaces the password hash of a user with one of the same password
+// computed with the current hashing parameters.
+func (r *UserRepository) RehashPassword(ctx context.Context, id, hash string) error {
+	return r.setPassword(ctx, id, hash, model.AuditActionPasswordRehash)
+}
+
+func (r *UserRepository) setPassword(ctx context.Context, id, hash, action string) error {
+	return inTx(ctx, r.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE users SET password=$1 WHERE id=$2", hash, id)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return sql.ErrNoRows
+		}
+		event := auditEvent(ctx, action, "user", id)
+		// Password resets and re-hashes on login happen without a signed-in actor.
+		if event.ActorID == "" {
+			event.ActorID = id
+		}
+		event.Changes = map[string]model.FieldChange{
+			"password": {Before: model.RedactedValue, After: model.RedactedValue},
+		}
+		return appendAuditEvent(ctx, tx, event)
+	})
+}
+
+// ListUsers retrieves all users from the read replica.
 func (r *UserRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
-	rows, err := r.db.QueryContext(ctx, "SELECT id, full_name, email, phone_number, role, created_at FROM users")
+	rows, err := r.replica.QueryContext(ctx, "SELECT id, full_name, email, phone_number, role, is_service_account, created_at, version FROM users")
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +198,7 @@ func (r *UserRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
 	var users []*model.User
 	for rows.Next() {
 		user := &model.User{}
-		if err := rows.Scan(&user.ID, &user.FullName, &user.Email, &user.PhoneNumber, &user.Role, &user.CreatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.FullName, &user.Email, &user.PhoneNumber, &user.Role, &user.IsServiceAccount, &user.CreatedAt, &user.Version); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -72,8 +209,8 @@ func (r *UserRepository) ListUsers(ctx context.Context) ([]*model.User, error) {
 // GetUserByEmail retrieves a user by their email from the database.
 func (r *UserRepository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	user := &model.User{}
-	err := r.db.QueryRowContext(ctx, "SELECT id, full_name, email, password, phone_number, role, created_at FROM users WHERE email=$1", email).
-		Scan(&user.ID, &user.FullName, &user.Email, &user.Password, &user.PhoneNumber, &user.Role, &user.CreatedAt)
+	err := r.db.QueryRowContext(ctx, "SELECT id, full_name, email, password, phone_number, role, is_service_account, created_at, version FROM users WHERE email=$1", email).
+		Scan(&user.ID, &user.FullName, &user.Email, &user.Password, &user.PhoneNumber, &user.Role, &user.IsServiceAccount, &user.CreatedAt, &user.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,19 @@
+package repository
+
+import "errors"
+
+// ErrVersionConflict is returned by version-checked updates when the row was changed
+// since the caller read it.
+var ErrVersionConflict = errors.New("row was modified concurrently")
+
+// AnyVersion disables the version check of an update.
+const AnyVersion int64 = 0
+
+// checkVersion compares the version of a row locked for update with the one the
+// caller expects.
+func checkVersion(current, expected int64) error {
+	if expected != AnyVersion && current != expected {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package router groups HTTP routes with the middleware chains that guard them and
+// keeps a table of every route so the exposure of the API can be reviewed.
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// Middleware wraps the handlers of a group or route.
+type Middleware struct {
+	// Name describes the middleware in the route table, e.g. "auth" or "role:admin".
+	Name string
+	Wrap func(http.Handler) http.Handler
+}
+
+// Use names a middleware function.
+func Use(name string, wrap func(http.Handler) http.Handler) Middleware {
+	return Middleware{Name: name, Wrap: wrap}
+}
+
+// Route is an entry of the route table.
+type Route struct {
+	Method string
+	Path   string
+	// Middleware lists the names of the middleware a request passes, outermost first.
+	Middleware []string
+}
+
+// Router registers routes on an http.ServeMux. Every route is registered with its full
+// method and path pattern, so a group never shadows the routes of another.
+type Router struct {
+	mux        *http.ServeMux
+	routes     *[]Route
+	prefix     string
+	middleware []Middleware
+}
+
+// New returns an empty router.
+func New() *Router {
+	return &Router{mux: http.NewServeMux(), routes: &[]Route{}}
+}
+
+// Group returns a router for routes under prefix that run middleware, outermost first,
+// after the middleware of r.
+func (r *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		mux:        r.mux,
+		routes:     r.routes,
+		prefix:     r.prefix + prefix,
+		middleware: append(append([]Middleware(nil), r.middleware...), middleware...),
+	}
+}
+
+// Handle registers h for method and path, which may contain {wildcards}. An empty method
+// matches every method. The route runs the middleware of its group, then middleware.
+func (r *Router) Handle(method, path string, h http.Handler, middleware ...Middleware) {
+	chain := append(append([]Middleware(nil), r.middleware...), middleware...)
+	names := make([]string, len(chain))
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i].Wrap(h)
+		names[i] = chain[i].Name
+	}
+	pattern := r.prefix + path
+	if method != "" {
+		pattern = method + " " + pattern
+	}
+	r.mux.Handle(pattern, h)
+	*r.routes = append(*r.routes, Route{Method: method, Path: r.prefix + path, Middleware: names})
+}
+
+// HandleFunc registers a handler function like Handle.
+func (r *Router) HandleFunc(method, path string, h http.HandlerFunc, middleware ...Middleware) {
+	r.Handle(method, path, h, middleware...)
+}
+
+// Routes returns the routes registered on r and all routers sharing its table, in
+// registration order.
+func (r *Router) Routes() []Route {
+	return append([]Route(nil), *r.routes...)
+}
+
+// WriteRoutes writes the route table with the middleware of every route.
+func (r *Router) WriteRoutes(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tMIDDLEWARE")
+	for _, route := range *r.routes {
+		method := route.Method
+		if method == "" {
+			method = "*"
+		}
+		middleware := strings.Join(route.Middleware, " > ")
+		if middleware == "" {
+			middleware = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", method, route.Path, middleware)
+	}
+	return tw.Flush()
+}
+
+// probeMethods are the methods probed to build the Allow header of a 405 response.
+var probeMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// ServeHTTP dispatches the request to its route. Requests that match no route get problem
+// details instead of the plain-text errors of http.ServeMux: 405 with an Allow header
+// listing the methods the path supports, or 404.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if _, pattern := r.mux.Handler(req); pattern != "" {
+		if meta, ok := util.RequestMetaFromContext(req.Context()); ok {
+			// Drop the method of patterns like "GET /users/{id}"
+			_, path, found := strings.Cut(pattern, " ")
+			if !found {
+				path = pattern
+			}
+			meta.Route = path
+		}
+		r.mux.ServeHTTP(w, req)
+		return
+	}
+	var allowed []string
+	for _, method := range probeMethods {
+		probe := req.Clone(req.Context())
+		probe.Method = method
+		if _, pattern := r.mux.Handler(probe); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) == 0 {
+		util.HTTPError(w, req, http.StatusNotFound, "not_found", "Not found")
+		return
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	util.HTTPError(w, req, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+}
@@ -0,0 +1,139 @@
+// Package server runs the HTTP server with hardened timeouts, optional TLS and graceful
+// shutdown, next to an optional plain HTTP listener for metrics.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Config holds the listen address, timeouts and TLS files of the server.
+type Config struct {
+	Port              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on shutdown.
+	ShutdownTimeout time.Duration
+	// TLSCertFile and TLSKeyFile enable HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// MetricsAddr is the host:port of the listener that serves metrics, kept apart from
+	// the public one. Empty disables it.
+	MetricsAddr string
+}
+
+// Server is an http.Server that shuts down gracefully and can reload its TLS certificate.
+type Server struct {
+	http            *http.Server
+	metrics         *http.Server
+	certs           *certReloader
+	shutdownTimeout time.Duration
+}
+
+// New creates a server for handler, and for metricsHandler on cfg.MetricsAddr if that is
+// set. The TLS certificate, if configured, is loaded right away.
+func New(cfg Config, handler, metricsHandler http.Handler) (*Server, error) {
+	s := &Server{
+		http: &http.Server{
+			Addr:              ":" + cfg.Port,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    1 << 20,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}
+	if cfg.MetricsAddr != "" {
+		s.metrics = &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           metricsHandler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+			MaxHeaderBytes:    1 << 20,
+		}
+	}
+	if cfg.TLSCertFile != "" {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		s.http.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
+		}
+	}
+	return s, nil
+}
+
+// Run serves until ctx is cancelled and then shuts down: it stops accepting connections
+// and waits up to the shutdown timeout for in-flight requests, closing whatever is left.
+// It returns an error if either listener could not be started or the server was not
+// drained in time.
+func (s *Server) Run(ctx context.Context) error {
+	serveErr := make(chan error, 1)
+	metricsErr := make(chan error, 1)
+	if s.metrics != nil {
+		go func() {
+			slog.Info("Metrics server running", "addr", s.metrics.Addr)
+			metricsErr <- s.metrics.ListenAndServe()
+		}()
+	}
+	go func() {
+		if s.certs != nil {
+			slog.Info("Server running", "addr", s.http.Addr, "tls", true)
+			serveErr <- s.http.ListenAndServeTLS("", "")
+		} else {
+			slog.Info("Server running", "addr", s.http.Addr, "tls", false)
+			serveErr <- s.http.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.closeMetrics()
+		return err
+	case err := <-metricsErr:
+		s.http.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", s.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+	// Metrics stay available while the requests drain
+	defer s.closeMetrics()
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		s.http.Close()
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) closeMetrics() {
+	if s.metrics != nil {
+		s.metrics.Close()
+	}
+}
+
+// ReloadCertificate reloads the TLS certificate and key from disk. It is a no-op without TLS.
+func (s *Server) ReloadCertificate() error {
+	if s.certs == nil {
+		return nil
+	}
+	return s.certs.reload()
+}
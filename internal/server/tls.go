@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval limits how often the certificate files are checked for changes.
+const certCheckInterval = time.Minute
+
+// certReloader serves a TLS certificate from files and picks up renewed files, either when
+// asked to reload or when their modification time changes.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	modTime, _ := c.latestModTime()
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.lastCheck = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// latestModTime returns the later modification time of the certificate and key files.
+func (c *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. A renewed certificate that fails to
+// load is logged and the previous one is kept.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	cert, modTime, due := c.cert, c.modTime, time.Since(c.lastCheck) > certCheckInterval
+	c.mu.RUnlock()
+	if !due {
+		return cert, nil
+	}
+
+	c.mu.Lock()
+	c.lastCheck = time.Now()
+	c.mu.Unlock()
+	if latest, err := c.latestModTime(); err == nil && latest.After(modTime) {
+		if err := c.reload(); err != nil {
+			slog.Error("Failed to reload TLS certificate, keeping the current one", "error", err)
+		} else {
+			slog.Info("Reloaded TLS certificate")
+		}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+var (
+	// ErrInvalidAPIKey is returned when a presented key is unknown, revoked or expired.
+	ErrInvalidAPIKey = newError(KindUnauthorized, "invalid_api_key", "Invalid or expired API key")
+	// ErrInvalidAPIKeyRequest is returned with the rejected fields when creating a key.
+	ErrInvalidAPIKeyRequest = newError(KindValidation, "invalid_api_key_request", "Invalid API key request")
+	// ErrNotServiceAccount is returned when an admin manages keys of a regular user.
+	ErrNotServiceAccount      = newError(KindValidation, "not_service_account", "User is not a service account")
+	ErrServiceAccountNotFound = newError(KindNotFound, "service_account_not_found", "Service account not found")
+	ErrAPIKeyNotFound         = newError(KindNotFound, "api_key_not_found", "API key not found")
+)
+
+const (
+	// apiKeyPrefix marks a credential as an API key rather than a JWT.
+	apiKeyPrefix = "isk_"
+
+	defaultAPIKeyLifetimeDays = 90
+	maxAPIKeyLifetimeDays     = 365
+
+	// apiKeyTouchInterval limits how often last_used_at is written for a busy key.
+	apiKeyTouchInterval = time.Minute
+)
+
+type APIKeyService struct {
+	repo     repository.APIKeyStore
+	userRepo repository.UserStore
+}
+
+func NewAPIKeyService(repo repository.APIKeyStore, userRepo repository.UserStore) *APIKeyService {
+	return &APIKeyService{repo: repo, userRepo: userRepo}
+}
+
+// IsAPIKey reports whether a credential taken from a request looks like an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// CreateKey generates a new key for the user. The returned plaintext key is never
+// stored and cannot be retrieved again.
+func (s *APIKeyService) CreateKey(ctx context.Context, userID string, req *model.CreateAPIKeyRequest) (_ string, _ *model.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.CreateKey")
+	defer tracing.End(span, &err)
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return "", nil, ErrInvalidAPIKeyRequest.WithFields(model.FieldError{Field: "name", Code: "length", Message: "must be between 1 and 100 characters"})
+	}
+	if len(req.Scopes) == 0 {
+		return "", nil, ErrInvalidAPIKeyRequest.WithFields(model.FieldError{Field: "scopes", Code: "required", Message: "at least one scope is required"})
+	}
+	for _, scope := range req.Scopes {
+		if !model.IsValidScope(scope) {
+			return "", nil, ErrInvalidAPIKeyRequest.WithFields(model.FieldError{Field: "scopes", Code: "unknown_scope", Message: fmt.Sprintf("unknown scope %q", scope)})
+		}
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyLifetimeDays
+	}
+	if days < 0 || days > maxAPIKeyLifetimeDays {
+		return "", nil, ErrInvalidAPIKeyRequest.WithFields(model.FieldError{Field: "expires_in_days", Code: "range", Message: fmt.Sprintf("must be between 1 and %d", maxAPIKeyLifetimeDays)})
+	}
+
+	prefix, err := randomHex(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := apiKeyPrefix + prefix + "_" + secret
+
+	key := &model.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    apiKeyPrefix + prefix,
+		KeyHash:   hashToken(plaintext),
+		Scopes:    req.Scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, days),
+	}
+	created, err := s.repo.CreateKey(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	return plaintext, created, nil
+}
+
+// CreateServiceAccountKey generates a key for a service account on behalf of an admin.
+func (s *APIKeyService) CreateServiceAccountKey(ctx context.Context, accountID string, req *model.CreateAPIKeyRequest) (_ string, _ *model.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.CreateServiceAccountKey")
+	defer tracing.End(span, &err)
+	if err := s.requireServiceAccount(ctx, accountID); err != nil {
+		return "", nil, err
+	}
+	return s.CreateKey(ctx, accountID, req)
+}
+
+func (s *APIKeyService) ListKeys(ctx context.Context, userID string) (_ []*model.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.ListKeys")
+	defer tracing.End(span, &err)
+	return s.repo.ListKeys(ctx, userID)
+}
+
+// ListServiceAccountKeys lists the keys of a service account on behalf of an admin.
+func (s *APIKeyService) ListServiceAccountKeys(ctx context.Context, accountID string) (_ []*model.APIKey, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.ListServiceAccountKeys")
+	defer tracing.End(span, &err)
+	if err := s.requireServiceAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListKeys(ctx, accountID)
+}
+
+func (s *APIKeyService) RevokeKey(ctx context.Context, userID, keyID string) (err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.RevokeKey")
+	defer tracing.End(span, &err)
+	return notFound(s.repo.RevokeKey(ctx, userID, keyID, time.Now()), ErrAPIKeyNotFound)
+}
+
+// Authenticate resolves a plaintext API key to the claims of the user owning it.
+func (s *APIKeyService) Authenticate(ctx context.Context, plaintext string) (_ *util.Claims, err error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Authenticate")
+	defer tracing.End(span, &err)
+	key, err := s.repo.GetKeyByHash(ctx, hashToken(plaintext))
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if key.RevokedAt != nil || !key.ExpiresAt.After(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	user, err := s.userRepo.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.repo.TouchKey(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+	}
+	return &util.Claims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Role:     user.Role,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+func (s *APIKeyService) requireServiceAccount(ctx context.Context, accountID string) error {
+	user, err := s.userRepo.GetUserByID(ctx, accountID)
+	if err != nil {
+		return notFound(err, ErrServiceAccountNotFound)
+	}
+	if !user.IsServiceAccount {
+		return ErrNotServiceAccount
+	}
+	return nil
+}
+
+// hashToken returns the hex SHA-256 of a secret token, which is what gets stored.
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
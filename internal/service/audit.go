@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+)
+
+type AuditService struct {
+	repo repository.AuditStore
+}
+
+func NewAuditService(repo repository.AuditStore) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record appends an event to the audit log.
+func (s *AuditService) Record(ctx context.Context, event *model.AuditEvent) (err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer tracing.End(span, &err)
+	return s.repo.CreateEvent(ctx, event)
+}
+
+// ListEvents returns the events matching the filter, newest first.
+func (s *AuditService) ListEvents(ctx context.Context, filter *model.AuditFilter) (_ []*model.AuditEvent, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.ListEvents")
+	defer tracing.End(span, &err)
+	return s.repo.ListEvents(ctx, filter)
+}
+
+// VerifyChain checks that no event in the audit log has been altered, removed or reordered.
+func (s *AuditService) VerifyChain(ctx context.Context) (_ *model.AuditChainReport, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyChain")
+	defer tracing.End(span, &err)
+	return s.repo.VerifyChain(ctx)
+}
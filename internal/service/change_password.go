@@ -2,53 +2,125 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
+	"database/sql"
+	"log/slog"
 	"time"
 
-	"github.com/minab/internship-backend/internal/model"
 	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
 	"github.com/minab/internship-backend/internal/util"
 )
 
+var (
+	// ErrNotPasswordUser is returned for service accounts, which have no usable password.
+	ErrNotPasswordUser = newError(KindForbidden, "not_password_user", "Service accounts cannot use password authentication")
+	// ErrInvalidResetToken is returned when a reset token is unknown or already used.
+	ErrInvalidResetToken = newError(KindValidation, "invalid_reset_token", "Invalid or already used reset token")
+	// ErrResetTokenExpired is returned when a reset token is past its expiry.
+	ErrResetTokenExpired = newError(KindValidation, "reset_token_expired", "The reset token has expired, request a new one")
+)
+
+// passwordResetLifetime bounds how long a reset link can be used.
+const passwordResetLifetime = 15 * time.Minute
+
 type PasswordResetService struct {
-	repo     *repository.PasswordResetRepository
-	userRepo *repository.UserRepository
+	tx            repository.Transactor
+	repo          repository.PasswordResetStore
+	userRepo      repository.UserStore
+	sessions      repository.SessionStore
+	apiKeys       repository.APIKeyStore
+	verifications repository.EmailVerificationStore
+	passwords     *PasswordService
 }
 
-func NewPasswordResetService(repo *repository.PasswordResetRepository, userRepo *repository.UserRepository) *PasswordResetService {
-	return &PasswordResetService{repo: repo, userRepo: userRepo}
+func NewPasswordResetService(tx repository.Transactor, repo repository.PasswordResetStore, userRepo repository.UserStore, sessions repository.SessionStore, apiKeys repository.APIKeyStore, verifications repository.EmailVerificationStore, passwords *PasswordService) *PasswordResetService {
+	return &PasswordResetService{tx: tx, repo: repo, userRepo: userRepo, sessions: sessions, apiKeys: apiKeys, verifications: verifications, passwords: passwords}
 }
 
-func (s *PasswordResetService) GenerateToken(ctx context.Context, email string) (string, error) {
+// GenerateToken issues a reset token for the user with the given email. Only its hash
+// is stored, so the returned token must be sent to the user.
+func (s *PasswordResetService) GenerateToken(ctx context.Context, email string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.GenerateToken")
+	defer tracing.End(span, &err)
 	user, err := s.userRepo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return "", err
+		return "", notFound(err, ErrUserNotFound)
+	}
+	if user.IsServiceAccount {
+		return "", ErrNotPasswordUser
 	}
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
+	token, err := randomHex(32)
+	if err != nil {
 		return "", err
 	}
-	token := hex.EncodeToString(b)
-	expiresAt := time.Now().Add(15 * time.Minute)
-	if err := s.repo.CreateToken(ctx, token, user.ID, expiresAt); err != nil {
+	if err := s.repo.CreateToken(ctx, hashToken(token), user.ID, time.Now().Add(passwordResetLifetime)); err != nil {
 		return "", err
 	}
 	return token, nil
 }
 
-func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
-	t, err := s.repo.GetToken(ctx, token)
-	if err != nil || t.ExpiresAt.Before(time.Now()) {
+// ResetPassword sets the password of the user the token was issued for. In the same
+// transaction it consumes the token, so that of concurrent resets with one token only
+// the first succeeds, and invalidates every other credential that might be in the
+// wrong hands: the user's sessions, API keys, outstanding reset tokens and pending
+// email change.
+// A confirmation is then emailed to the user.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	ctx, span := tracing.Start(ctx, "PasswordResetService.ResetPassword")
+	defer tracing.End(span, &err)
+	tokenHash := hashToken(token)
+	t, err := s.repo.GetToken(ctx, tokenHash)
+	if err != nil {
+		return notFound(err, ErrInvalidResetToken)
+	}
+	if t.ExpiresAt.Before(time.Now()) {
+		return ErrResetTokenExpired
+	}
+	user, err := s.userRepo.GetUserByID(ctx, t.UserID)
+	if err != nil {
+		return notFound(err, ErrUserNotFound)
+	}
+	hashed, err := s.passwords.Hash(ctx, user, newPassword)
+	if err != nil {
 		return err
 	}
-	hashed, err := util.HashPassword(newPassword)
+	err = s.tx.WithinTx(ctx, func(tx *sql.Tx) error {
+		if err := s.repo.WithTx(tx).DeleteToken(ctx, tokenHash); err != nil {
+			return notFound(err, ErrInvalidResetToken)
+		}
+		if err := s.passwords.Store(ctx, tx, user.ID, hashed); err != nil {
+			return err
+		}
+		if _, err := s.repo.WithTx(tx).DeleteUserTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		if _, err := s.verifications.WithTx(tx).DeleteUserTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		now := time.Now()
+		if _, err := s.sessions.WithTx(tx).RevokeAllSessions(ctx, user.ID, "", now); err != nil {
+			return err
+		}
+		_, err := s.apiKeys.WithTx(tx).RevokeAllKeys(ctx, user.ID, now)
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	user := &model.User{ID: t.UserID, Password: hashed}
-	if _, err := s.userRepo.UpdateUser(ctx, t.UserID, user); err != nil {
+
+	// The password has changed whether or not the confirmation arrives.
+	if err := sendPasswordChanged(ctx, user.Email); err != nil {
+		slog.WarnContext(ctx, "Failed to send password change confirmation", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+func sendPasswordChanged(ctx context.Context, email string) error {
+	body, err := util.RenderEmailTemplate("password_changed.html", map[string]string{
+		"ForgotPasswordLink": util.FrontendLink("/forgot-password"),
+	})
+	if err != nil {
 		return err
 	}
-	return s.repo.DeleteToken(ctx, token)
+	return util.SendEmail(ctx, email, "Your Password Was Changed", body)
 }
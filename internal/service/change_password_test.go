@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+const newTestPassword = "Battery-Staple-77"
+
+func TestPasswordReset(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+
+	token, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the hash of the token is stored
+	if _, err := f.resets.GetToken(ctx, token); err == nil {
+		t.Fatal("reset token stored in plain text")
+	}
+	if _, err := f.resets.GetToken(ctx, hashToken(token)); err != nil {
+		t.Fatalf("stored token hash: %v", err)
+	}
+	if err := f.resetSvc.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.userSvc.Authenticate(ctx, alice.Email, newTestPassword); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	_, err = f.userSvc.Authenticate(ctx, alice.Email, testPassword)
+	wantErr(t, err, ErrInvalidCredentials)
+
+	// Tokens are single-use
+	err = f.resetSvc.ResetPassword(ctx, token, "Another-Secret-99")
+	wantErr(t, err, ErrInvalidResetToken)
+}
+
+func TestPasswordResetRejections(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	robot, err := f.userSvc.CreateServiceAccount(ctx, &model.CreateServiceAccountRequest{FullName: "Robot", Email: "robot@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.resetSvc.GenerateToken(ctx, "nobody@example.com")
+	wantErr(t, err, ErrUserNotFound)
+	_, err = f.resetSvc.GenerateToken(ctx, robot.Email)
+	wantErr(t, err, ErrNotPasswordUser)
+
+	err = f.resetSvc.ResetPassword(ctx, "unknown-token", newTestPassword)
+	wantErr(t, err, ErrInvalidResetToken)
+
+	if err := f.resets.CreateToken(ctx, hashToken("expired-token"), alice.ID, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	err = f.resetSvc.ResetPassword(ctx, "expired-token", newTestPassword)
+	wantErr(t, err, ErrResetTokenExpired)
+
+	// A rejected password leaves the token usable
+	token, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.resetSvc.ResetPassword(ctx, token, testPassword)
+	wantErr(t, err, ErrPasswordPolicy)
+	if err := f.resetSvc.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatalf("reset after a rejected password: %v", err)
+	}
+}
+
+func TestPasswordResetKeepsProfile(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	admin := &util.Claims{UserID: alice.ID, Role: model.RoleAdmin}
+	before, _, err := f.userSvc.UpdateUser(ctx, admin, alice.ID, repository.AnyVersion, &model.UpdateUserRequest{
+		FullName: "Alice Liddell", Email: alice.Email, PhoneNumber: "+15551234567", Role: model.RoleMentor,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.resetSvc.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	after, err := f.userSvc.GetUser(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *after != *before {
+		t.Fatalf("user after reset = %+v, want %+v", after, before)
+	}
+}
+
+func TestPasswordResetRevokesCredentials(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	bob := f.createUser(t, "bob@example.com")
+	for i, userID := range []string{alice.ID, alice.ID, bob.ID} {
+		if _, err := f.sessions.CreateSession(ctx, &model.Session{UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+		key := &model.APIKey{UserID: userID, Name: "ci", Prefix: "mk_test", KeyHash: hashToken(fmt.Sprint("key-", i))}
+		if _, err := f.apiKeys.CreateKey(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailChange := &model.EmailVerificationToken{TokenHash: hashToken("email-change"), UserID: alice.ID, Email: "mallory@example.com", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := f.emails.CreateToken(ctx, emailChange); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.resetSvc.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatal(err)
+	}
+	if sessions, _ := f.sessions.ListActiveSessions(ctx, alice.ID, time.Now()); len(sessions) != 0 {
+		t.Fatalf("%d sessions of alice still active", len(sessions))
+	}
+	if sessions, _ := f.sessions.ListActiveSessions(ctx, bob.ID, time.Now()); len(sessions) != 1 {
+		t.Fatalf("bob has %d active sessions, want 1", len(sessions))
+	}
+	if keys, _ := f.apiKeys.ListKeys(ctx, alice.ID); len(keys) != 0 {
+		t.Fatalf("%d API keys of alice still active", len(keys))
+	}
+	if keys, _ := f.apiKeys.ListKeys(ctx, bob.ID); len(keys) != 1 {
+		t.Fatalf("bob has %d active API keys, want 1", len(keys))
+	}
+	err = f.resetSvc.ResetPassword(ctx, otherToken, "Another-Secret-99")
+	wantErr(t, err, ErrInvalidResetToken)
+	if _, err := f.emails.ConsumeToken(ctx, emailChange.TokenHash); err == nil {
+		t.Fatal("pending email change survived the reset")
+	}
+}
+
+func TestPasswordResetTokenRequiresUser(t *testing.T) {
+	f := newFixture(t)
+	err := f.resets.CreateToken(context.Background(), "orphan", "00000000-0000-4000-8000-000000000000", time.Now().Add(time.Minute))
+	if !isForeignKeyViolation(err) {
+		t.Fatalf("got %v, want a foreign key violation", err)
+	}
+}
+
+// failingPasswordUpdates is a user store whose password updates fail, after running
+// during if it is set.
+type failingPasswordUpdates struct {
+	repository.UserStore
+	during func()
+}
+
+var errPasswordUpdate = errors.New("password update failed")
+
+func (s failingPasswordUpdates) WithTx(tx *sql.Tx) repository.UserStore {
+	return failingPasswordUpdates{s.UserStore.WithTx(tx), s.during}
+}
+
+func (s failingPasswordUpdates) UpdatePassword(context.Context, string, string) error {
+	if s.during != nil {
+		s.during()
+	}
+	return errPasswordUpdate
+}
+
+func TestPasswordResetRollsBack(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	token, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice logs in elsewhere while the reset is under way
+	login := make(chan error, 1)
+	failing := failingPasswordUpdates{UserStore: f.users, during: func() {
+		go func() {
+			_, err := f.sessions.CreateSession(ctx, &model.Session{UserID: alice.ID, ExpiresAt: time.Now().Add(time.Hour)})
+			login <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+	}}
+	passwords := NewPasswordService(f.passwords.policy, failing, f.history)
+	resets := NewPasswordResetService(f.db, f.resets, failing, f.sessions, f.apiKeys, f.emails, passwords)
+	err = resets.ResetPassword(ctx, token, newTestPassword)
+	if !errors.Is(err, errPasswordUpdate) {
+		t.Fatalf("got %v, want %v", err, errPasswordUpdate)
+	}
+	if err := <-login; err != nil {
+		t.Fatal(err)
+	}
+
+	// The token deleted in the failed transaction is back, and the rollback did not
+	// undo the login made outside it
+	if _, err := f.resets.GetToken(ctx, hashToken(token)); err != nil {
+		t.Fatalf("token after rollback: %v", err)
+	}
+	if sessions, _ := f.sessions.ListActiveSessions(ctx, alice.ID, time.Now()); len(sessions) != 1 {
+		t.Fatalf("alice has %d active sessions after the rollback, want 1", len(sessions))
+	}
+	if err := f.resetSvc.ResetPassword(ctx, token, newTestPassword); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPasswordResetConcurrentUse(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	token, err := f.resetSvc.GenerateToken(ctx, alice.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const attempts = 5
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- f.resetSvc.ResetPassword(ctx, token, newTestPassword)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrInvalidResetToken):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d resets succeeded with one token, want 1", succeeded)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// ErrInvalidVerificationToken is returned when an email verification token is unknown,
+// already used or expired.
+var ErrInvalidVerificationToken = newError(KindValidation, "invalid_verification_token", "Invalid or expired verification token")
+
+// emailVerificationLifetime bounds how long a new email address may take to be confirmed.
+const emailVerificationLifetime = 24 * time.Hour
+
+// EmailVerificationService confirms that a user controls a new email address before
+// it replaces their current one.
+type EmailVerificationService struct {
+	repo     repository.EmailVerificationStore
+	userRepo repository.UserStore
+}
+
+func NewEmailVerificationService(repo repository.EmailVerificationStore, userRepo repository.UserStore) *EmailVerificationService {
+	return &EmailVerificationService{repo: repo, userRepo: userRepo}
+}
+
+// RequestChange sends a verification link to newEmail. The user's email is only
+// changed once the link is confirmed.
+func (s *EmailVerificationService) RequestChange(ctx context.Context, user *model.User, newEmail string) (err error) {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.RequestChange")
+	defer tracing.End(span, &err)
+	if err := s.ensureEmailFree(ctx, user.ID, newEmail); err != nil {
+		return err
+	}
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.CreateToken(ctx, &model.EmailVerificationToken{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Email:     newEmail,
+		ExpiresAt: time.Now().Add(emailVerificationLifetime),
+	}); err != nil {
+		return err
+	}
+	body, err := util.RenderEmailTemplate("verify_email.html", map[string]string{
+		"VerifyLink": util.FrontendLink("/verify-email?token=" + token),
+	})
+	if err != nil {
+		return err
+	}
+	return util.SendEmail(ctx, newEmail, "Confirm Your New Email", body)
+}
+
+// Confirm redeems a verification token and applies the new email address.
+func (s *EmailVerificationService) Confirm(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "EmailVerificationService.Confirm")
+	defer tracing.End(span, &err)
+	t, err := s.repo.ConsumeToken(ctx, hashToken(token))
+	if err != nil {
+		return notFound(err, ErrInvalidVerificationToken)
+	}
+	if t.ExpiresAt.Before(time.Now()) {
+		return ErrInvalidVerificationToken
+	}
+	// The address may have been taken since the change was requested.
+	if err := s.ensureEmailFree(ctx, t.UserID, t.Email); err != nil {
+		return err
+	}
+	return userWriteError(s.userRepo.UpdateEmail(ctx, t.UserID, t.Email))
+}
+
+func (s *EmailVerificationService) ensureEmailFree(ctx context.Context, userID, email string) error {
+	other, err := s.userRepo.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return err
+	case other.ID != userID:
+		return ErrEmailTaken
+	}
+	return nil
+}
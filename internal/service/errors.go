@@ -0,0 +1,124 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+// ErrorKind classifies a service error so the API layer can pick an HTTP status for it.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindConflict
+	// KindPreconditionFailed means the entity changed since the client read it.
+	KindPreconditionFailed
+	// KindUnavailable is a failure of an external dependency, such as an identity provider.
+	KindUnavailable
+)
+
+// Error is an expected failure of a service operation. Code is a stable, machine-readable
+// identifier; Message is safe to show to clients. Two errors match with errors.Is when
+// their kinds and codes are equal, so detailed copies still match the sentinel they came from.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	// Fields lists the rejected fields of a validation error.
+	Fields []model.FieldError
+	// Err is the underlying cause, which is never shown to clients.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// WithFields returns a copy of e that lists the rejected fields.
+func (e *Error) WithFields(fields ...model.FieldError) *Error {
+	c := *e
+	c.Fields = append(append([]model.FieldError(nil), e.Fields...), fields...)
+	return &c
+}
+
+func newError(kind ErrorKind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// Errors shared by several services.
+var (
+	ErrUserNotFound = newError(KindNotFound, "user_not_found", "User not found")
+	ErrEmailTaken   = newError(KindConflict, "email_taken", "A user with this email already exists")
+	// ErrInvalidUser is returned when the database rejects user fields that passed request validation.
+	ErrInvalidUser = newError(KindValidation, "invalid_user", "User data violates a database constraint")
+)
+
+// versionConflict replaces repository.ErrVersionConflict with the given error.
+func versionConflict(err error, conflictErr *Error) error {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return conflictErr.Wrap(err)
+	}
+	return err
+}
+
+// notFound replaces sql.ErrNoRows with the given not-found error.
+func notFound(err error, notFoundErr *Error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFoundErr.Wrap(err)
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isCheckViolation reports whether err is a PostgreSQL CHECK constraint violation.
+func isCheckViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23514"
+}
+
+// isForeignKeyViolation reports whether err is a PostgreSQL foreign key violation.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// userWriteError translates the database errors of creating or updating a user.
+func userWriteError(err error) error {
+	if isUniqueViolation(err) {
+		return ErrEmailTaken.Wrap(err)
+	}
+	if isCheckViolation(err) {
+		return ErrInvalidUser.Wrap(err)
+	}
+	return notFound(err, ErrUserNotFound)
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// healthCheckTimeout bounds each readiness check.
+const healthCheckTimeout = 2 * time.Second
+
+type HealthService struct {
+	repo      repository.HealthStore
+	checkSMTP bool
+}
+
+// NewHealthService creates a health service. With checkSMTP, readiness also requires the
+// mail server to be reachable.
+func NewHealthService(repo repository.HealthStore, checkSMTP bool) *HealthService {
+	return &HealthService{repo: repo, checkSMTP: checkSMTP}
+}
+
+// Readiness checks that the database is reachable and migrated to repository.SchemaVersion,
+// and optionally that the mail server is reachable.
+func (s *HealthService) Readiness(ctx context.Context) *model.Readiness {
+	checks := map[string]func(context.Context) error{
+		"database":   s.repo.Ping,
+		"migrations": s.checkMigrations,
+	}
+	if s.checkSMTP {
+		checks["smtp"] = util.PingSMTP
+	}
+
+	readiness := &model.Readiness{Status: model.HealthStatusOK, Checks: make(map[string]model.HealthCheck)}
+	for name, check := range checks {
+		result := runHealthCheck(ctx, name, check)
+		if result.Status != model.HealthStatusOK {
+			readiness.Status = model.HealthStatusUnavailable
+		}
+		readiness.Checks[name] = result
+	}
+	return readiness
+}
+
+func (s *HealthService) checkMigrations(ctx context.Context) error {
+	version, err := s.repo.AppliedSchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version != repository.SchemaVersion {
+		return fmt.Errorf("schema version is %d, expected %d", version, repository.SchemaVersion)
+	}
+	return nil
+}
+
+// runHealthCheck runs the check called name, logging why it failed.
+func runHealthCheck(ctx context.Context, name string, check func(context.Context) error) model.HealthCheck {
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := check(checkCtx)
+	result := model.HealthCheck{Status: model.HealthStatusOK, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = model.HealthStatusUnavailable
+		slog.WarnContext(ctx, "Readiness check failed", "check", name, "error", err)
+	}
+	return result
+}
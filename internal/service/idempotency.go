@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a different request.
+	ErrIdempotencyKeyReused = newError(KindConflict, "idempotency_key_reused", "This Idempotency-Key was already used for a different request")
+	// ErrIdempotencyInProgress is returned while the first request with a key is still being handled.
+	ErrIdempotencyInProgress = newError(KindConflict, "idempotency_key_in_progress", "A request with this Idempotency-Key is still in progress")
+)
+
+// IdempotencyKeyLifetime is how long the response to an idempotent request is replayed.
+const IdempotencyKeyLifetime = 24 * time.Hour
+
+type IdempotencyService struct {
+	repo repository.IdempotencyStore
+}
+
+func NewIdempotencyService(repo repository.IdempotencyStore) *IdempotencyService {
+	return &IdempotencyService{repo: repo}
+}
+
+// Begin starts a request sent with an idempotency key. It returns the stored response when
+// the key was already used for the same request, or nil after reserving the key, in which
+// case the caller must handle the request and then call Complete or Release.
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key, requestHash string) (_ *model.IdempotencyRecord, err error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Begin")
+	defer tracing.End(span, &err)
+	now := time.Now()
+	reserved, err := s.repo.Reserve(ctx, &model.IdempotencyRecord{
+		Scope:       scope,
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(IdempotencyKeyLifetime),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+	record, err := s.repo.GetRecord(ctx, scope, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The first request failed and released the key after Reserve saw it.
+		return nil, ErrIdempotencyInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if record.StatusCode == 0 {
+		return nil, ErrIdempotencyInProgress
+	}
+	return record, nil
+}
+
+// Complete stores the response to replay for a key reserved by Begin.
+func (s *IdempotencyService) Complete(ctx context.Context, scope, key string, status int, header map[string][]string, body []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Complete")
+	defer tracing.End(span, &err)
+	return s.repo.Complete(ctx, scope, key, status, header, body)
+}
+
+// Release frees a key reserved by Begin so that the request can be retried.
+func (s *IdempotencyService) Release(ctx context.Context, scope, key string) (err error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Release")
+	defer tracing.End(span, &err)
+	return s.repo.Release(ctx, scope, key)
+}
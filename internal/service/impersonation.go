@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// ErrCannotImpersonate is returned when the target may not be impersonated: the admin
+// themself, another admin, or a request that is already impersonating.
+var ErrCannotImpersonate = newError(KindForbidden, "cannot_impersonate", "This user cannot be impersonated")
+
+type ImpersonationService struct {
+	userRepo repository.UserStore
+	audit    *AuditService
+}
+
+func NewImpersonationService(userRepo repository.UserStore, audit *AuditService) *ImpersonationService {
+	return &ImpersonationService{userRepo: userRepo, audit: audit}
+}
+
+// Start issues a short-lived token that lets the admin described by admin act as the
+// target user, and records it in the audit log.
+func (s *ImpersonationService) Start(ctx context.Context, admin *util.Claims, targetID string) (_ string, _ time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "ImpersonationService.Start")
+	defer tracing.End(span, &err)
+	if admin.IsImpersonated() || admin.IsAPIKey() || admin.UserID == targetID {
+		return "", time.Time{}, ErrCannotImpersonate
+	}
+	target, err := s.userRepo.GetUserByID(ctx, targetID)
+	if err != nil {
+		return "", time.Time{}, notFound(err, ErrUserNotFound)
+	}
+	if target.Role == model.RoleAdmin {
+		return "", time.Time{}, ErrCannotImpersonate
+	}
+	token, expiresAt, err := util.GenerateImpersonationJWT(target.ID, target.Email, target.Role, admin.UserID, admin.SessionID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := s.audit.Record(ctx, &model.AuditEvent{
+		ActorID:    admin.UserID,
+		Action:     model.AuditActionImpersonationStart,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Metadata:   map[string]any{"expires_at": expiresAt},
+	}); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
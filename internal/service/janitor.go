@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/minab/internship-backend/internal/metrics"
+	"github.com/minab/internship-backend/internal/repository"
+)
+
+// janitorTask deletes one kind of expired record.
+type janitorTask struct {
+	name string
+	// job labels the task in the background job metrics.
+	job   string
+	purge func(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Janitor is a background worker that periodically deletes expired idempotency keys,
+// pending social logins and password reset and email verification tokens.
+type Janitor struct {
+	interval time.Duration
+	tasks    []janitorTask
+}
+
+func NewJanitor(interval time.Duration, idempotency repository.IdempotencyStore, identities repository.IdentityStore, resets repository.PasswordResetStore, verifications repository.EmailVerificationStore) *Janitor {
+	return &Janitor{
+		interval: interval,
+		tasks: []janitorTask{
+			{"idempotency keys", "janitor_idempotency_keys", idempotency.DeleteExpired},
+			{"OIDC login states", "janitor_oidc_login_states", identities.DeleteExpiredLoginStates},
+			{"password reset tokens", "janitor_password_reset_tokens", resets.DeleteExpired},
+			{"email verification tokens", "janitor_email_verification_tokens", verifications.DeleteExpired},
+		},
+	}
+}
+
+// Run purges expired records right away and then every interval until ctx is cancelled.
+// A purge that is under way when ctx is cancelled is finished before Run returns.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		j.purge(context.WithoutCancel(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *Janitor) purge(ctx context.Context) {
+	now := time.Now()
+	for _, task := range j.tasks {
+		start := time.Now()
+		n, err := task.purge(ctx, now)
+		metrics.ObserveJob(task.job, n, time.Since(start), err)
+		if err != nil {
+			slog.ErrorContext(ctx, "Janitor failed to delete expired records", "records", task.name, "error", err)
+			continue
+		}
+		if n > 0 {
+			slog.InfoContext(ctx, "Janitor deleted expired records", "records", task.name, "count", n)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownOIDCProvider = newError(KindNotFound, "unknown_provider", "Unknown identity provider")
+	// ErrInvalidLoginState is returned when the callback state is unknown, already used,
+	// expired or was issued for another provider.
+	ErrInvalidLoginState = newError(KindValidation, "invalid_login_state", "Invalid or expired login")
+	// ErrInvalidLogin is returned when the provider rejects the authorization code or
+	// returns an ID token that fails verification.
+	ErrInvalidLogin = newError(KindValidation, "invalid_login", "Invalid or expired login")
+	// ErrProviderUnavailable is returned when the provider cannot be reached.
+	ErrProviderUnavailable = newError(KindUnavailable, "identity_provider_unavailable", "Identity provider unavailable")
+	// ErrEmailNotVerified is returned when the provider does not vouch for the email,
+	// which is required to link the identity to a user.
+	ErrEmailNotVerified = newError(KindForbidden, "email_not_verified", "Identity provider did not return a verified email")
+	// ErrServiceAccountLogin is returned when an external identity resolves to a service account.
+	ErrServiceAccountLogin = newError(KindForbidden, "service_account_login", "Service accounts cannot sign in with an external identity")
+)
+
+// oidcLoginStateLifetime bounds how long a user may take at the provider's login page.
+const oidcLoginStateLifetime = 10 * time.Minute
+
+type OIDCService struct {
+	providers    map[string]*util.OIDCProvider
+	identityRepo repository.IdentityStore
+	userRepo     repository.UserStore
+}
+
+func NewOIDCService(providers []*util.OIDCProvider, identityRepo repository.IdentityStore, userRepo repository.UserStore) *OIDCService {
+	byName := make(map[string]*util.OIDCProvider, len(providers))
+	for _, p := range providers {
+		byName[p.Name] = p
+	}
+	return &OIDCService{providers: byName, identityRepo: identityRepo, userRepo: userRepo}
+}
+
+// BeginLogin stores a fresh state, nonce and PKCE verifier and returns the provider's
+// authorization URL to redirect the user to.
+func (s *OIDCService) BeginLogin(ctx context.Context, providerName string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.BeginLogin")
+	defer tracing.End(span, &err)
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", ErrUnknownOIDCProvider
+	}
+	state, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	loginState := &model.OIDCLoginState{
+		State:        state,
+		Provider:     providerName,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginStateLifetime),
+	}
+	if err := s.identityRepo.CreateLoginState(ctx, loginState); err != nil {
+		return "", err
+	}
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, loginState.CodeVerifier)
+	if err != nil {
+		return "", ErrProviderUnavailable.Wrap(err)
+	}
+	return authURL, nil
+}
+
+// CompleteLogin redeems the authorization code and returns the user the external
+// identity belongs to. Unknown identities are linked to the user with the same
+// verified email, or a new applicant is created for them.
+func (s *OIDCService) CompleteLogin(ctx context.Context, providerName, code, state string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "OIDCService.CompleteLogin")
+	defer tracing.End(span, &err)
+	user, err := s.completeLogin(ctx, providerName, code, state)
+	observeLogin("oidc", err)
+	return user, err
+}
+
+func (s *OIDCService) completeLogin(ctx context.Context, providerName, code, state string) (*model.User, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	loginState, err := s.identityRepo.ConsumeLoginState(ctx, state)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidLoginState
+		}
+		return nil, err
+	}
+	if loginState.Provider != providerName || loginState.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidLoginState
+	}
+	identity, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		return nil, ErrInvalidLogin.Wrap(err)
+	}
+
+	linked, err := s.identityRepo.GetIdentity(ctx, providerName, identity.Subject)
+	if err == nil {
+		return s.userForLogin(ctx, linked.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	user, err := s.userRepo.GetUserByEmail(ctx, identity.Email)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = s.createUserForIdentity(ctx, identity)
+		if err != nil {
+			return nil, userWriteError(err)
+		}
+	case err != nil:
+		return nil, err
+	case user.IsServiceAccount:
+		return nil, ErrServiceAccountLogin
+	}
+
+	if _, err := s.identityRepo.CreateIdentity(ctx, &model.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *OIDCService) userForLogin(ctx context.Context, userID string) (*model.User, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	if user.IsServiceAccount {
+		return nil, ErrServiceAccountLogin
+	}
+	return user, nil
+}
+
+func (s *OIDCService) createUserForIdentity(ctx context.Context, identity *util.OIDCIdentity) (*model.User, error) {
+	name := strings.TrimSpace(identity.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	// Full names are limited to 100 characters, not bytes
+	if utf8.RuneCountInString(name) > 100 {
+		name = string([]rune(name)[:100])
+	}
+	// Users created from an external identity get a random password they never learn;
+	// they can set one later through the password reset flow.
+	password, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := hashPassword(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+	return s.userRepo.CreateUser(ctx, &model.User{
+		FullName: name,
+		Email:    identity.Email,
+		Password: hashed,
+		Role:     model.RoleApplicant,
+	})
+}
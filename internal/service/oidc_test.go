@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/oidctest"
+	"github.com/minab/internship-backend/internal/repository/memory"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// oidcFixture wires OIDCService to in-memory stores and a test provider, configured
+// under the names "stub" and "other".
+type oidcFixture struct {
+	*fixture
+	identities *memory.IdentityStore
+	provider   *oidctest.Provider
+	oidc       *OIDCService
+}
+
+func newOIDCFixture(t *testing.T) *oidcFixture {
+	t.Helper()
+	f := &oidcFixture{fixture: newFixture(t), provider: oidctest.New(t)}
+	f.identities = memory.NewIdentityStore(f.db)
+	providers := []*util.OIDCProvider{
+		util.NewOIDCProvider("stub", f.provider.URL, oidctest.ClientID, "secret", "http://localhost/callback", nil),
+		util.NewOIDCProvider("other", f.provider.URL, oidctest.ClientID, "secret", "http://localhost/callback", nil),
+	}
+	f.oidc = NewOIDCService(providers, f.identities, f.users)
+	return f
+}
+
+// begin starts a login at the stub provider and returns the code the provider issues
+// for an ID token with claims, and the state to complete the login with.
+func (f *oidcFixture) begin(t *testing.T, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	authURL, err := f.oidc.BeginLogin(context.Background(), "stub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.provider.Authorize(t, authURL, claims), u.Query().Get("state")
+}
+
+// login runs a whole login at the stub provider.
+func (f *oidcFixture) login(t *testing.T, claims jwt.MapClaims) (*model.User, error) {
+	t.Helper()
+	code, state := f.begin(t, claims)
+	return f.oidc.CompleteLogin(context.Background(), "stub", code, state)
+}
+
+// replaceLoginState swaps the stored login state for the one edit returns.
+func (f *oidcFixture) replaceLoginState(t *testing.T, state string, edit func(model.OIDCLoginState) model.OIDCLoginState) {
+	t.Helper()
+	ctx := context.Background()
+	stored, err := f.identities.ConsumeLoginState(ctx, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := edit(*stored)
+	if err := f.identities.CreateLoginState(ctx, &edited); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCLinksVerifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	alice := f.createUser(t, "alice@example.com")
+
+	user, err := f.login(t, jwt.MapClaims{"email": alice.Email, "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Fatalf("logged in as %s, want alice %s", user.ID, alice.ID)
+	}
+	identity, err := f.identities.GetIdentity(context.Background(), "stub", oidctest.Subject)
+	if err != nil || identity.UserID != alice.ID {
+		t.Fatalf("identity = %+v, %v; want one linked to alice", identity, err)
+	}
+
+	// Once linked, the subject decides, whatever the provider now says about the email
+	user, err = f.login(t, jwt.MapClaims{"email": "renamed@example.com", "email_verified": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Fatalf("logged in as %s, want alice %s", user.ID, alice.ID)
+	}
+}
+
+func TestOIDCRefusesUnverifiedEmail(t *testing.T) {
+	f := newOIDCFixture(t)
+	alice := f.createUser(t, "alice@example.com")
+
+	for _, claims := range []jwt.MapClaims{
+		{"email": alice.Email, "email_verified": false},
+		{"email": alice.Email},
+		{"email_verified": true},
+	} {
+		_, err := f.login(t, claims)
+		wantErr(t, err, ErrEmailNotVerified)
+	}
+	if _, err := f.identities.GetIdentity(context.Background(), "stub", oidctest.Subject); err != sql.ErrNoRows {
+		t.Fatalf("GetIdentity = %v, want no identity linked", err)
+	}
+	if users, _ := f.users.ListUsers(context.Background()); len(users) != 1 {
+		t.Fatalf("%d users, want only alice", len(users))
+	}
+}
+
+func TestOIDCCreatesUser(t *testing.T) {
+	f := newOIDCFixture(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		wantName string
+	}{
+		{
+			name:     "name from the provider",
+			claims:   jwt.MapClaims{"sub": "subject-name", "email": "grace@example.com", "email_verified": true, "name": " Grace Hopper "},
+			wantName: "Grace Hopper",
+		},
+		{
+			name:     "name from the email",
+			claims:   jwt.MapClaims{"sub": "subject-email", "email": "ada@example.com", "email_verified": true},
+			wantName: "ada",
+		},
+		{
+			name:     "long multi-byte name",
+			claims:   jwt.MapClaims{"sub": "subject-long", "email": "zoe@example.com", "email_verified": true, "name": strings.Repeat("é", 150)},
+			wantName: strings.Repeat("é", 100),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := f.login(t, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.FullName != tt.wantName || !utf8.ValidString(user.FullName) {
+				t.Errorf("full name = %q, want %q", user.FullName, tt.wantName)
+			}
+			if user.Email != tt.claims["email"] || user.Role != model.RoleApplicant {
+				t.Errorf("created %+v, want an applicant with the provider's email", user)
+			}
+			identity, err := f.identities.GetIdentity(ctx, "stub", tt.claims["sub"].(string))
+			if err != nil || identity.UserID != user.ID {
+				t.Errorf("identity = %+v, %v; want one linked to the new user", identity, err)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	f := newOIDCFixture(t)
+	ctx := context.Background()
+	claims := jwt.MapClaims{"email": "alice@example.com", "email_verified": true}
+
+	_, err := f.oidc.BeginLogin(ctx, "unknown")
+	wantErr(t, err, ErrUnknownOIDCProvider)
+	_, err = f.oidc.CompleteLogin(ctx, "stub", "code", "unknown-state")
+	wantErr(t, err, ErrInvalidLoginState)
+
+	// The state is only valid for the provider it was issued for, and is consumed
+	// even by a failed attempt
+	code, state := f.begin(t, claims)
+	_, err = f.oidc.CompleteLogin(ctx, "other", code, state)
+	wantErr(t, err, ErrInvalidLoginState)
+	_, err = f.oidc.CompleteLogin(ctx, "stub", code, state)
+	wantErr(t, err, ErrInvalidLoginState)
+
+	code, state = f.begin(t, claims)
+	f.replaceLoginState(t, state, func(s model.OIDCLoginState) model.OIDCLoginState {
+		s.ExpiresAt = time.Now().Add(-time.Second)
+		return s
+	})
+	_, err = f.oidc.CompleteLogin(ctx, "stub", code, state)
+	wantErr(t, err, ErrInvalidLoginState)
+
+	// The provider only redeems the code for the verifier stored with the state
+	code, state = f.begin(t, claims)
+	f.replaceLoginState(t, state, func(s model.OIDCLoginState) model.OIDCLoginState {
+		s.CodeVerifier = "not-the-verifier-used-for-the-challenge-0123456789"
+		return s
+	})
+	_, err = f.oidc.CompleteLogin(ctx, "stub", code, state)
+	wantErr(t, err, ErrInvalidLogin)
+
+	code, state = f.begin(t, claims)
+	if _, err := f.oidc.CompleteLogin(ctx, "stub", code, state); err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.oidc.CompleteLogin(ctx, "stub", code, state)
+	wantErr(t, err, ErrInvalidLoginState)
+}
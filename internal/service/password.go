@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// PasswordPolicy describes the rules every new password must satisfy.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// HistorySize is how many previous passwords (including the current one) may not be reused.
+	HistorySize int
+	// CheckBreached rejects passwords found in the bundled breached-password list.
+	CheckBreached bool
+}
+
+// ErrPasswordPolicy is returned for a rejected password. Its fields list every rule
+// the password failed, each with a machine-readable code.
+var ErrPasswordPolicy = newError(KindValidation, "password_policy", "Password does not meet the password policy")
+
+// PasswordService enforces the password policy and keeps the password history used
+// to prevent reuse. All password changes should go through it.
+type PasswordService struct {
+	policy      PasswordPolicy
+	userRepo    repository.UserStore
+	historyRepo repository.PasswordHistoryStore
+}
+
+func NewPasswordService(policy PasswordPolicy, userRepo repository.UserStore, historyRepo repository.PasswordHistoryStore) *PasswordService {
+	return &PasswordService{policy: policy, userRepo: userRepo, historyRepo: historyRepo}
+}
+
+// Validate checks password against the policy for user. For a user that does not
+// exist yet (empty ID) the history check is skipped. It returns ErrPasswordPolicy
+// listing every failed rule.
+func (s *PasswordService) Validate(ctx context.Context, password string, user *model.User) (err error) {
+	ctx, span := tracing.Start(ctx, "PasswordService.Validate")
+	defer tracing.End(span, &err)
+	var violations []model.FieldError
+	add := func(code, format string, args ...any) {
+		violations = append(violations, model.FieldError{Field: "password", Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := len([]rune(password))
+	if length < s.policy.MinLength {
+		add("too_short", "must be at least %d characters long", s.policy.MinLength)
+	}
+	if s.policy.MaxLength > 0 && len(password) > s.policy.MaxLength {
+		add("too_long", "must be at most %d bytes long", s.policy.MaxLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if s.policy.RequireUpper && !hasUpper {
+		add("missing_upper", "must contain an uppercase letter")
+	}
+	if s.policy.RequireLower && !hasLower {
+		add("missing_lower", "must contain a lowercase letter")
+	}
+	if s.policy.RequireDigit && !hasDigit {
+		add("missing_digit", "must contain a digit")
+	}
+	if s.policy.RequireSymbol && !hasSymbol {
+		add("missing_symbol", "must contain a symbol")
+	}
+
+	if containsPersonalInfo(password, user) {
+		add("contains_personal_info", "must not contain your email or name")
+	}
+	if s.policy.CheckBreached && password != "" && util.IsBreachedPassword(password) {
+		add("breached", "appears in a list of breached passwords")
+	}
+
+	if user.ID != "" && s.policy.HistorySize > 0 && password != "" {
+		hashes, err := s.historyRepo.ListRecentHashes(ctx, user.ID, s.policy.HistorySize)
+		if err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			if ok, _ := checkPassword(ctx, password, h); ok {
+				add("reused", "must not match any of your last %d passwords", s.policy.HistorySize)
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return ErrPasswordPolicy.WithFields(violations...)
+	}
+	return nil
+}
+
+// Hash validates password against the policy for user and hashes it. Hashing is slow,
+// so it is done before the transaction that stores the hash is started.
+func (s *PasswordService) Hash(ctx context.Context, user *model.User, password string) (string, error) {
+	if err := s.Validate(ctx, password, user); err != nil {
+		return "", err
+	}
+	return hashPassword(ctx, password)
+}
+
+// Store replaces the password hash of a user and records it in the history within tx.
+func (s *PasswordService) Store(ctx context.Context, tx *sql.Tx, userID, hash string) error {
+	if err := s.userRepo.WithTx(tx).UpdatePassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	return s.Remember(ctx, tx, userID, hash)
+}
+
+// Remember records a password hash in the user's history within tx.
+func (s *PasswordService) Remember(ctx context.Context, tx *sql.Tx, userID, hash string) (err error) {
+	ctx, span := tracing.Start(ctx, "PasswordService.Remember")
+	defer tracing.End(span, &err)
+	if s.policy.HistorySize <= 0 {
+		return nil
+	}
+	return s.historyRepo.WithTx(tx).AddPasswordHash(ctx, userID, hash, s.policy.HistorySize)
+}
+
+// hashPassword hashes password in a span of its own, as hashing is deliberately slow.
+func hashPassword(ctx context.Context, password string) (_ string, err error) {
+	_, span := tracing.Start(ctx, "password.hash")
+	defer tracing.End(span, &err)
+	return util.HashPassword(password)
+}
+
+// checkPassword compares password with hash in a span of its own, as hashing is
+// deliberately slow.
+func checkPassword(ctx context.Context, password, hash string) (ok, outdated bool) {
+	_, span := tracing.Start(ctx, "password.verify")
+	defer span.End()
+	return util.CheckPasswordHash(password, hash)
+}
+
+// containsPersonalInfo reports whether password contains the user's email, the local
+// part of it, or any part of their name of three or more characters.
+func containsPersonalInfo(password string, user *model.User) bool {
+	lower := strings.ToLower(password)
+	var parts []string
+	if email := strings.ToLower(user.Email); email != "" {
+		local, _, _ := strings.Cut(email, "@")
+		parts = append(parts, email, local)
+	}
+	parts = append(parts, strings.Fields(strings.ToLower(user.FullName))...)
+	for _, p := range parts {
+		if len(p) >= 3 && strings.Contains(lower, p) {
+			return true
+		}
+	}
+	return false
+}
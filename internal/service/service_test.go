@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository/memory"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+const testPassword = "Correct-Horse-42"
+
+func TestMain(m *testing.M) {
+	// Cheap hashing keeps the suite fast; the parameters are not what is under test.
+	if err := util.ConfigurePasswordHashing(util.PasswordHashing{
+		Algorithm:         util.HashAlgorithmArgon2id,
+		Argon2Memory:      8,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fixture wires the user, password and password reset services to in-memory stores.
+type fixture struct {
+	db        *memory.DB
+	users     *memory.UserStore
+	history   *memory.PasswordHistoryStore
+	resets    *memory.PasswordResetStore
+	sessions  *memory.SessionStore
+	apiKeys   *memory.APIKeyStore
+	emails    *memory.EmailVerificationStore
+	passwords *PasswordService
+	userSvc   *UserService
+	resetSvc  *PasswordResetService
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{db: memory.NewDB()}
+	f.users = memory.NewUserStore(f.db)
+	f.history = memory.NewPasswordHistoryStore(f.db)
+	f.resets = memory.NewPasswordResetStore(f.db)
+	f.sessions = memory.NewSessionStore(f.db)
+	f.apiKeys = memory.NewAPIKeyStore(f.db)
+	f.emails = memory.NewEmailVerificationStore(f.db)
+	policy := PasswordPolicy{MinLength: 10, RequireUpper: true, RequireLower: true, RequireDigit: true, HistorySize: 3}
+	f.passwords = NewPasswordService(policy, f.users, f.history)
+	verifications := NewEmailVerificationService(f.emails, f.users)
+	f.userSvc = NewUserService(f.db, f.users, f.passwords, verifications)
+	f.resetSvc = NewPasswordResetService(f.db, f.resets, f.users, f.sessions, f.apiKeys, f.emails, f.passwords)
+	return f
+}
+
+// createUser registers a user with testPassword through UserService.
+func (f *fixture) createUser(t *testing.T, email string) *model.User {
+	t.Helper()
+	user, err := f.userSvc.CreateUser(context.Background(), &model.CreateUserRequest{
+		FullName: "Test User",
+		Email:    email,
+		Password: testPassword,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+// wantErr fails the test unless err matches want.
+func wantErr(t *testing.T, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
+	"github.com/minab/internship-backend/internal/util"
+)
+
+// ErrSessionInvalid is returned when a token refers to a session that is unknown,
+// revoked, expired or owned by another user.
+var ErrSessionInvalid = newError(KindUnauthorized, "session_invalid", "Session expired or revoked")
+
+// ErrSessionNotFound is returned when the user has no active session with the given ID.
+var ErrSessionNotFound = newError(KindNotFound, "session_not_found", "Session not found")
+
+// sessionTouchInterval limits how often last_seen_at is written for a busy session.
+const sessionTouchInterval = time.Minute
+
+type SessionService struct {
+	repo repository.SessionStore
+}
+
+func NewSessionService(repo repository.SessionStore) *SessionService {
+	return &SessionService{repo: repo}
+}
+
+// StartSession records a new login for the user. The session lives as long as the JWT issued for it.
+func (s *SessionService) StartSession(ctx context.Context, userID, userAgent, ipAddress string) (_ *model.Session, err error) {
+	ctx, span := tracing.Start(ctx, "SessionService.StartSession")
+	defer tracing.End(span, &err)
+	session := &model.Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: time.Now().Add(util.TokenLifetime),
+	}
+	return s.repo.CreateSession(ctx, session)
+}
+
+// ValidateSession checks that the session exists, belongs to userID and is still active,
+// and refreshes its last-seen timestamp.
+func (s *SessionService) ValidateSession(ctx context.Context, sessionID, userID string) (err error) {
+	ctx, span := tracing.Start(ctx, "SessionService.ValidateSession")
+	defer tracing.End(span, &err)
+	if sessionID == "" {
+		return ErrSessionInvalid
+	}
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if err != nil {
+		return ErrSessionInvalid
+	}
+	now := time.Now()
+	if session.UserID != userID || session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+		return ErrSessionInvalid
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := s.repo.TouchSession(ctx, sessionID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionService) ListSessions(ctx context.Context, userID string) (_ []*model.Session, err error) {
+	ctx, span := tracing.Start(ctx, "SessionService.ListSessions")
+	defer tracing.End(span, &err)
+	return s.repo.ListActiveSessions(ctx, userID, time.Now())
+}
+
+func (s *SessionService) RevokeSession(ctx context.Context, userID, sessionID string) (err error) {
+	ctx, span := tracing.Start(ctx, "SessionService.RevokeSession")
+	defer tracing.End(span, &err)
+	return notFound(s.repo.RevokeSession(ctx, userID, sessionID, time.Now()), ErrSessionNotFound)
+}
+
+// RevokeOtherSessions revokes every session of the user except currentID.
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID, currentID string) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "SessionService.RevokeOtherSessions")
+	defer tracing.End(span, &err)
+	return s.repo.RevokeAllSessions(ctx, userID, currentID, time.Now())
+}
+
+// RevokeAllSessions revokes every session of the user, logging them out everywhere.
+func (s *SessionService) RevokeAllSessions(ctx context.Context, userID string) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "SessionService.RevokeAllSessions")
+	defer tracing.End(span, &err)
+	return s.repo.RevokeAllSessions(ctx, userID, "", time.Now())
+}
@@ -2,47 +2,272 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
 
+	"github.com/minab/internship-backend/internal/metrics"
 	"github.com/minab/internship-backend/internal/model"
 	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/tracing"
 	"github.com/minab/internship-backend/internal/util"
 )
 
-type UserService struct {
-	repo *repository.UserRepository
-}
+// ErrInvalidCredentials is returned when an email and password do not match an account
+// that may log in with a password.
+var ErrInvalidCredentials = newError(KindUnauthorized, "invalid_credentials", "Invalid email or password")
+
+// dummyPasswordHash is compared against when the email is unknown, so a failed login
+// takes about as long whether or not the account exists.
+var dummyPasswordHash, _ = util.HashPassword("dummy-password-for-timing")
+
+var (
+	// ErrCannotUpdateUser is returned when a non-admin tries to update another user.
+	ErrCannotUpdateUser = newError(KindForbidden, "cannot_update_user", "You can only update your own account")
+	// ErrFieldNotAllowed is returned with the fields the caller may not change.
+	ErrFieldNotAllowed = newError(KindForbidden, "field_not_allowed", "You are not allowed to change some of these fields")
+	// ErrUserModified is returned when the user changed since the version the client read.
+	ErrUserModified = newError(KindPreconditionFailed, "version_conflict", "The user was modified by someone else; fetch it again and retry")
+	// ErrCannotDeleteUser is returned when a non-admin tries to delete a user.
+	ErrCannotDeleteUser = newError(KindForbidden, "cannot_delete_user", "Only admins can delete users")
+	// ErrCannotDeleteSelf is returned when an admin tries to delete their own account.
+	ErrCannotDeleteSelf = newError(KindForbidden, "cannot_delete_self", "You cannot delete your own account")
+	// ErrUserInUse is returned when a user cannot be deleted because other records refer to them.
+	ErrUserInUse = newError(KindConflict, "user_in_use", "The user is still referenced by other records, such as approvals or templates they created")
+	// ErrImpersonationDenied is returned for credential changes made while impersonating.
+	ErrImpersonationDenied = newError(KindForbidden, "impersonation_denied", "Cannot change the password while impersonating a user")
+)
 
-func NewUserService(repo *repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+type UserService struct {
+	tx            repository.Transactor
+	repo          repository.UserStore
+	passwords     *PasswordService
+	verifications *EmailVerificationService
 }
 
-func (s *UserService) GetUser(ctx context.Context, id string) (*model.User, error) {
-	return s.repo.GetUserByID(ctx, id)
+func NewUserService(tx repository.Transactor, repo repository.UserStore, passwords *PasswordService, verifications *EmailVerificationService) *UserService {
+	return &UserService{tx: tx, repo: repo, passwords: passwords, verifications: verifications}
 }
 
-func (s *UserService) CreateUser(ctx context.Context, req *model.CreateUserRequest) (*model.User, error) {
-	hashed, err := util.HashPassword(req.Password)
+func (s *UserService) GetUser(ctx context.Context, id string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUser")
+	defer tracing.End(span, &err)
+	user, err := s.repo.GetUserByID(ctx, id)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err, ErrUserNotFound)
 	}
+	return user, nil
+}
+
+func (s *UserService) CreateUser(ctx context.Context, req *model.CreateUserRequest) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer tracing.End(span, &err)
 	user := &model.User{
 		FullName:    req.FullName,
 		Email:       req.Email,
-		Password:    hashed,
 		PhoneNumber: req.PhoneNumber,
-		Role:        req.Role,
+		Role:        model.RoleApplicant,
+	}
+	if err := s.passwords.Validate(ctx, req.Password, user); err != nil {
+		return nil, err
+	}
+	hashed, err := hashPassword(ctx, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = hashed
+	var created *model.User
+	err = s.tx.WithinTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if created, err = s.repo.WithTx(tx).CreateUser(ctx, user); err != nil {
+			return userWriteError(err)
+		}
+		return s.passwords.Remember(ctx, tx, created.ID, hashed)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return s.repo.CreateUser(ctx, user)
+	return created, nil
 }
 
-func (s *UserService) UpdateUser(ctx context.Context, id string, user *model.User) (*model.User, error) {
-	return s.repo.UpdateUser(ctx, id, user)
+// CreateServiceAccount creates a user that cannot log in with a password and can
+// only authenticate with API keys.
+func (s *UserService) CreateServiceAccount(ctx context.Context, req *model.CreateServiceAccountRequest) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateServiceAccount")
+	defer tracing.End(span, &err)
+	role := req.Role
+	if role == "" {
+		role = model.RoleApplicant
+	}
+	// The password is random and never disclosed, so it can never be used to log in.
+	password, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := hashPassword(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{
+		FullName:         req.FullName,
+		Email:            req.Email,
+		Password:         hashed,
+		Role:             role,
+		IsServiceAccount: true,
+	}
+	created, err := s.repo.CreateUser(ctx, user)
+	if err != nil {
+		return nil, userWriteError(err)
+	}
+	return created, nil
 }
 
-func (s *UserService) ListUsers(ctx context.Context) ([]*model.User, error) {
+// UpdateUser replaces the profile of user id with req on behalf of actor, provided the user
+// is still at expectedVersion (repository.AnyVersion skips the check). Users may only update
+// themselves and only admins may change roles. A new email address is not applied but sent
+// a verification link; it is returned as pendingEmail.
+func (s *UserService) UpdateUser(ctx context.Context, actor *util.Claims, id string, expectedVersion int64, req *model.UpdateUserRequest) (user *model.User, pendingEmail string, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateUser")
+	defer tracing.End(span, &err)
+	isAdmin := actor.Role == model.RoleAdmin
+	if !isAdmin && actor.UserID != id {
+		return nil, "", ErrCannotUpdateUser
+	}
+	// The version is checked when the row is locked for the update
+	existing, err := s.GetUser(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if req.Role != "" && req.Role != existing.Role && !isAdmin {
+		return nil, "", ErrFieldNotAllowed.WithFields(model.FieldError{Field: "role", Code: "not_allowed", Message: "only admins may change roles"})
+	}
+	if req.Password != nil && actor.IsImpersonated() {
+		return nil, "", ErrImpersonationDenied
+	}
+
+	// The role is only written when an admin sets it; otherwise the repository keeps the
+	// role of the locked row, so a stale read cannot undo a concurrent role change
+	updated := *existing
+	updated.FullName = req.FullName
+	updated.PhoneNumber = req.PhoneNumber
+	updated.Role = ""
+	if isAdmin {
+		updated.Role = req.Role
+	}
+
+	// Check and hash the password before saving anything; the policy already sees the updated name
+	var hashed string
+	if req.Password != nil {
+		if hashed, err = s.passwords.Hash(ctx, &updated, *req.Password); err != nil {
+			return nil, "", err
+		}
+	}
+	var saved *model.User
+	err = s.tx.WithinTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if saved, err = s.repo.WithTx(tx).UpdateUser(ctx, id, &updated, expectedVersion); err != nil {
+			return versionConflict(userWriteError(err), ErrUserModified)
+		}
+		if req.Password != nil {
+			return s.passwords.Store(ctx, tx, id, hashed)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if req.Email != saved.Email {
+		if err := s.verifications.RequestChange(ctx, saved, req.Email); err != nil {
+			return nil, "", err
+		}
+		pendingEmail = req.Email
+	}
+	return saved, pendingEmail, nil
+}
+
+// DeleteUser deletes user id on behalf of actor, who must be an admin other than the user.
+func (s *UserService) DeleteUser(ctx context.Context, actor *util.Claims, id string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.DeleteUser")
+	defer tracing.End(span, &err)
+	if actor.Role != model.RoleAdmin {
+		return ErrCannotDeleteUser
+	}
+	if actor.UserID == id {
+		return ErrCannotDeleteSelf
+	}
+	err = s.repo.DeleteUser(ctx, id)
+	if isForeignKeyViolation(err) {
+		return ErrUserInUse.Wrap(err)
+	}
+	return notFound(err, ErrUserNotFound)
+}
+
+// Authenticate verifies an email and password. When the stored hash was made with an
+// outdated algorithm or cost it is transparently replaced with a fresh one.
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Authenticate")
+	defer tracing.End(span, &err)
+	user, err := s.authenticate(ctx, email, password)
+	observeLogin("password", err)
+	return user, err
+}
+
+func (s *UserService) authenticate(ctx context.Context, email, password string) (*model.User, error) {
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		checkPassword(ctx, password, dummyPasswordHash)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Service accounts can only authenticate with API keys.
+	if user.IsServiceAccount {
+		return nil, ErrInvalidCredentials
+	}
+	ok, outdated := checkPassword(ctx, password, user.Password)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if outdated {
+		if hashed, err := hashPassword(ctx, password); err != nil {
+			slog.ErrorContext(ctx, "Failed to re-hash password", "user_id", user.ID, "error", err)
+		} else if err := s.repo.RehashPassword(ctx, user.ID, hashed); err != nil {
+			slog.ErrorContext(ctx, "Failed to store re-hashed password", "user_id", user.ID, "error", err)
+		} else {
+			user.Password = hashed
+		}
+	}
+	return user, nil
+}
+
+// observeLogin counts a login attempt. Service errors such as wrong credentials are
+// failures of the client; anything else is an error of the server.
+func observeLogin(method string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+		var svcErr *Error
+		if errors.As(err, &svcErr) && svcErr.Kind != KindInternal && svcErr.Kind != KindUnavailable {
+			result = "failure"
+		}
+	}
+	metrics.Logins.WithLabelValues(method, result).Inc()
+}
+
+func (s *UserService) ListUsers(ctx context.Context) (_ []*model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.ListUsers")
+	defer tracing.End(span, &err)
 	return s.repo.ListUsers(ctx)
 }
 
-func (s *UserService) GetByEmail(ctx context.Context, email string) (*model.User, error) {
-	return s.repo.GetUserByEmail(ctx, email)
+func (s *UserService) GetByEmail(ctx context.Context, email string) (_ *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetByEmail")
+	defer tracing.End(span, &err)
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, notFound(err, ErrUserNotFound)
+	}
+	return user, nil
 }
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/minab/internship-backend/internal/model"
+	"github.com/minab/internship-backend/internal/repository"
+	"github.com/minab/internship-backend/internal/util"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCreateUser(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	user := f.createUser(t, "alice@example.com")
+	if user.ID == "" || user.Version != 1 || user.Role != model.RoleApplicant {
+		t.Fatalf("created user = %+v, want an ID, version 1 and the applicant role", user)
+	}
+	stored, err := f.users.GetUserByEmail(ctx, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password == testPassword {
+		t.Fatal("password stored in plain text")
+	}
+	if ok, _ := util.CheckPasswordHash(testPassword, stored.Password); !ok {
+		t.Fatal("stored hash does not match the password")
+	}
+	hashes, err := f.history.ListRecentHashes(ctx, user.ID, 10)
+	if err != nil || len(hashes) != 1 || hashes[0] != stored.Password {
+		t.Fatalf("password history = %v, %v; want the initial hash", hashes, err)
+	}
+}
+
+func TestCreateUserRejections(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	f.createUser(t, "taken@example.com")
+
+	tests := []struct {
+		name string
+		req  model.CreateUserRequest
+		want error
+	}{
+		{"duplicate email", model.CreateUserRequest{FullName: "Other", Email: "taken@example.com", Password: testPassword}, ErrEmailTaken},
+		{"weak password", model.CreateUserRequest{FullName: "Other", Email: "weak@example.com", Password: "short"}, ErrPasswordPolicy},
+		{"invalid phone", model.CreateUserRequest{FullName: "Other", Email: "phone@example.com", Password: testPassword, PhoneNumber: "12"}, ErrInvalidUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.userSvc.CreateUser(ctx, &tt.req)
+			wantErr(t, err, tt.want)
+			if _, err := f.users.GetUserByEmail(ctx, tt.req.Email); tt.req.Email != "taken@example.com" && err == nil {
+				t.Fatalf("rejected user %s was stored", tt.req.Email)
+			}
+		})
+	}
+
+	users, err := f.userSvc.ListUsers(ctx)
+	if err != nil || len(users) != 1 {
+		t.Fatalf("ListUsers = %d users, %v; want only the first one", len(users), err)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	created := f.createUser(t, "alice@example.com")
+
+	user, err := f.userSvc.GetUser(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != created.Email || user.Password != "" {
+		t.Fatalf("GetUser = %+v, want the user without a password hash", user)
+	}
+	_, err = f.userSvc.GetUser(ctx, "00000000-0000-4000-8000-000000000000")
+	wantErr(t, err, ErrUserNotFound)
+}
+
+func TestUpdateUser(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	bob := f.createUser(t, "bob@example.com")
+	self := &util.Claims{UserID: alice.ID, Role: model.RoleApplicant}
+	admin := &util.Claims{UserID: bob.ID, Role: model.RoleAdmin}
+	profile := func(role string) *model.UpdateUserRequest {
+		return &model.UpdateUserRequest{FullName: "Alice Liddell", Email: alice.Email, PhoneNumber: "+15551234567", Role: role}
+	}
+
+	updated, pending, err := f.userSvc.UpdateUser(ctx, self, alice.ID, alice.Version, profile(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.FullName != "Alice Liddell" || updated.Version != alice.Version+1 || pending != "" {
+		t.Fatalf("UpdateUser = %+v, pending %q; want the new name at the next version", updated, pending)
+	}
+
+	_, _, err = f.userSvc.UpdateUser(ctx, self, alice.ID, alice.Version, profile(""))
+	wantErr(t, err, ErrUserModified)
+
+	_, _, err = f.userSvc.UpdateUser(ctx, self, bob.ID, repository.AnyVersion, profile(""))
+	wantErr(t, err, ErrCannotUpdateUser)
+
+	_, _, err = f.userSvc.UpdateUser(ctx, self, alice.ID, repository.AnyVersion, profile(model.RoleAdmin))
+	wantErr(t, err, ErrFieldNotAllowed)
+
+	promoted, _, err := f.userSvc.UpdateUser(ctx, admin, alice.ID, repository.AnyVersion, profile(model.RoleMentor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Role != model.RoleMentor {
+		t.Fatalf("role = %q, want %q", promoted.Role, model.RoleMentor)
+	}
+}
+
+// staleUsers is a user store whose GetUserByID returns a copy of the user read before
+// a concurrent change.
+type staleUsers struct {
+	repository.UserStore
+	stale *model.User
+}
+
+func (s staleUsers) WithTx(tx *sql.Tx) repository.UserStore {
+	return staleUsers{s.UserStore.WithTx(tx), s.stale}
+}
+
+func (s staleUsers) GetUserByID(context.Context, string) (*model.User, error) {
+	stale := *s.stale
+	return &stale, nil
+}
+
+func TestUpdateUserKeepsConcurrentChanges(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	mentor := *alice
+	mentor.Role = model.RoleMentor
+	if _, err := f.users.UpdateUser(ctx, alice.ID, &mentor, repository.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice's profile is read while she is a mentor; meanwhile an admin demotes her and
+	// she confirms a new email address
+	stale, err := f.users.GetUserByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	demoted := *stale
+	demoted.Role = model.RoleApplicant
+	if _, err := f.users.UpdateUser(ctx, alice.ID, &demoted, repository.AnyVersion); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.users.UpdateEmail(ctx, alice.ID, "alice.new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	users := staleUsers{f.users, stale}
+	svc := NewUserService(f.db, users, f.passwords, NewEmailVerificationService(f.emails, users))
+	self := &util.Claims{UserID: alice.ID, Role: model.RoleMentor}
+	req := &model.UpdateUserRequest{FullName: "Alice Liddell", Email: "alice.new@example.com"}
+	saved, pending, err := svc.UpdateUser(ctx, self, alice.ID, repository.AnyVersion, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Role != model.RoleApplicant || saved.Email != "alice.new@example.com" || pending != "" {
+		t.Fatalf("saved %+v with pending email %q, want the demotion and new email kept", saved, pending)
+	}
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	self := &util.Claims{UserID: alice.ID, Role: model.RoleApplicant}
+	withPassword := func(password string) *model.UpdateUserRequest {
+		return &model.UpdateUserRequest{FullName: alice.FullName, Email: alice.Email, Password: &password}
+	}
+
+	// The current password is in the history and may not be reused
+	_, _, err := f.userSvc.UpdateUser(ctx, self, alice.ID, repository.AnyVersion, withPassword(testPassword))
+	wantErr(t, err, ErrPasswordPolicy)
+
+	const newPassword = "Battery-Staple-77"
+	if _, _, err := f.userSvc.UpdateUser(ctx, self, alice.ID, repository.AnyVersion, withPassword(newPassword)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.userSvc.Authenticate(ctx, alice.Email, newPassword); err != nil {
+		t.Fatalf("login with the new password: %v", err)
+	}
+	hashes, _ := f.history.ListRecentHashes(ctx, alice.ID, 10)
+	if len(hashes) != 2 {
+		t.Fatalf("password history has %d entries, want 2", len(hashes))
+	}
+
+	// Impersonators may not change the password
+	impersonated := &util.Claims{UserID: alice.ID, Role: model.RoleApplicant, ImpersonatorID: "admin"}
+	_, _, err = f.userSvc.UpdateUser(ctx, impersonated, alice.ID, repository.AnyVersion, withPassword("Another-Secret-99"))
+	wantErr(t, err, ErrImpersonationDenied)
+}
+
+func TestDeleteUser(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	admin := f.createUser(t, "admin@example.com")
+	adminClaims := &util.Claims{UserID: admin.ID, Role: model.RoleAdmin}
+	if _, err := f.sessions.CreateSession(ctx, &model.Session{UserID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := f.userSvc.DeleteUser(ctx, &util.Claims{UserID: alice.ID, Role: model.RoleApplicant}, admin.ID)
+	wantErr(t, err, ErrCannotDeleteUser)
+	err = f.userSvc.DeleteUser(ctx, adminClaims, admin.ID)
+	wantErr(t, err, ErrCannotDeleteSelf)
+
+	if err := f.userSvc.DeleteUser(ctx, adminClaims, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.userSvc.GetUser(ctx, alice.ID)
+	wantErr(t, err, ErrUserNotFound)
+	if n, _ := f.sessions.RevokeAllSessions(ctx, alice.ID, "", f.db.Now()); n != 0 {
+		t.Fatalf("%d sessions of the deleted user remain", n)
+	}
+	err = f.userSvc.DeleteUser(ctx, adminClaims, alice.ID)
+	wantErr(t, err, ErrUserNotFound)
+}
+
+func TestAuthenticate(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	robot, err := f.userSvc.CreateServiceAccount(ctx, &model.CreateServiceAccountRequest{FullName: "Robot", Email: "robot@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := f.userSvc.Authenticate(ctx, alice.Email, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != alice.ID {
+		t.Fatalf("authenticated %s, want %s", user.ID, alice.ID)
+	}
+
+	tests := []struct {
+		name, email, password string
+	}{
+		{"wrong password", alice.Email, "Wrong-Password-1"},
+		{"unknown email", "nobody@example.com", testPassword},
+		{"service account", robot.Email, testPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.userSvc.Authenticate(ctx, tt.email, tt.password)
+			wantErr(t, err, ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestAuthenticateRehashesOutdatedHash(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	legacy, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.users.UpdatePassword(ctx, alice.ID, string(legacy)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.userSvc.Authenticate(ctx, alice.Email, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := f.users.GetUserByEmail(ctx, alice.Email)
+	if ok, outdated := util.CheckPasswordHash(testPassword, stored.Password); !ok || outdated {
+		t.Fatalf("stored hash %q: ok %v, outdated %v; want a current hash of the password", stored.Password, ok, outdated)
+	}
+}
+
+func TestServiceSpansRecordErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	f := newFixture(t)
+	ctx := context.Background()
+	alice := f.createUser(t, "alice@example.com")
+	if _, err := f.userSvc.GetUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err := f.userSvc.Authenticate(ctx, alice.Email, "Wrong-Password-1")
+	wantErr(t, err, ErrInvalidCredentials)
+
+	statuses := map[string]codes.Code{}
+	for _, span := range recorder.Ended() {
+		statuses[span.Name()] = span.Status().Code
+	}
+	if statuses["UserService.GetUser"] != codes.Unset || statuses["UserService.Authenticate"] != codes.Error {
+		t.Fatalf("span statuses = %v, want GetUser unset and Authenticate error", statuses)
+	}
+}
@@ -0,0 +1,219 @@
+// Package testdb runs integration tests against a throwaway PostgreSQL server.
+//
+// Run starts a server from the local PostgreSQL binaries (initdb and pg_ctl, found in
+// PG_BIN, on the PATH or under /usr/lib/postgresql) in a temporary directory. It listens
+// only on a unix socket in that directory, so nothing is reachable over the network, and
+// is removed when the tests finish. migrations/schema.sql is applied once; Open empties
+// every table before handing the database to a test, so tests must not run in parallel.
+//
+// With TEST_DATABASE_URL set, that database is used instead of starting a server. Its
+// tables are dropped and recreated, so it must be a database set aside for tests.
+//
+// When no server can be started (the binaries are missing, or the tests run as root,
+// which initdb refuses) the tests that call Open are skipped.
+package testdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	db *sql.DB
+	// skipReason explains why db is nil.
+	skipReason string
+)
+
+// Run starts the database, runs the tests and stops the database again, returning the
+// exit code for os.Exit. Call it from TestMain.
+func Run(m *testing.M) int {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		srv, err := start()
+		if err != nil {
+			skipReason = err.Error()
+			return m.Run()
+		}
+		defer srv.stop()
+		url = srv.url()
+	}
+
+	var err error
+	db, err = sql.Open("postgres", url)
+	if err == nil {
+		err = migrate(db)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "testdb:", err)
+		return 1
+	}
+	defer db.Close()
+	return m.Run()
+}
+
+// Open returns the database with every table emptied, or skips t if there is none.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	if db == nil {
+		t.Skip("no PostgreSQL server for integration tests: " + skipReason)
+	}
+	if err := reset(context.Background(), db); err != nil {
+		t.Fatalf("reset test database: %v", err)
+	}
+	return db
+}
+
+// migrate applies the schema, which drops any tables left from an earlier run.
+func migrate(db *sql.DB) error {
+	path, err := schemaPath()
+	if err != nil {
+		return err
+	}
+	schema, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Without arguments the statements are sent as one simple query
+	if _, err := db.Exec(string(schema)); err != nil {
+		return fmt.Errorf("apply %s: %w", path, err)
+	}
+	return nil
+}
+
+// schemaPath finds migrations/schema.sql in the module root above the working directory,
+// which go test sets to the directory of the package under test.
+func schemaPath() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Join(dir, "migrations", "schema.sql"), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("go.mod not found above the working directory")
+		}
+		dir = parent
+	}
+}
+
+// reset truncates every table except schema_migrations. The audit log refuses to be
+// truncated, so its trigger is disabled for the duration of the transaction.
+func reset(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT quote_ident(tablename) FROM pg_tables WHERE schemaname = 'public' AND tablename <> 'schema_migrations'")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		tables = append(tables, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"ALTER TABLE audit_events DISABLE TRIGGER audit_events_no_truncate",
+		"TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE",
+		"ALTER TABLE audit_events ENABLE TRIGGER audit_events_no_truncate",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// server is a PostgreSQL server running in a temporary directory.
+type server struct {
+	bin, dir string
+}
+
+// port only names the socket file; the server does not listen on TCP.
+const port = "5432"
+
+func start() (*server, error) {
+	if os.Geteuid() == 0 {
+		return nil, errors.New("initdb cannot run as root")
+	}
+	bin, err := findBinaries()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "testdb")
+	if err != nil {
+		return nil, err
+	}
+	s := &server{bin: bin, dir: dir}
+
+	data := filepath.Join(dir, "data")
+	if err := s.run("initdb", "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// fsync is off: the data only has to survive the test run
+	opts := fmt.Sprintf("-c listen_addresses='' -k %s -p %s -F", dir, port)
+	if err := s.run("pg_ctl", "-D", data, "-l", filepath.Join(dir, "server.log"), "-o", opts, "-w", "start"); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *server) url() string {
+	return fmt.Sprintf("host=%s port=%s user=postgres dbname=postgres sslmode=disable", s.dir, port)
+}
+
+func (s *server) stop() {
+	if err := s.run("pg_ctl", "-D", filepath.Join(s.dir, "data"), "-m", "immediate", "-w", "stop"); err != nil {
+		fmt.Fprintln(os.Stderr, "testdb:", err)
+	}
+	os.RemoveAll(s.dir)
+}
+
+func (s *server) run(name string, args ...string) error {
+	out, err := exec.Command(filepath.Join(s.bin, name), args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w\n%s", name, err, out)
+	}
+	return nil
+}
+
+// findBinaries returns the directory holding initdb and pg_ctl.
+func findBinaries() (string, error) {
+	if dir := os.Getenv("PG_BIN"); dir != "" {
+		return dir, nil
+	}
+	if path, err := exec.LookPath("pg_ctl"); err == nil {
+		return filepath.Dir(path), nil
+	}
+	// Debian and Ubuntu keep the server binaries out of the PATH
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(dirs[i], "initdb")); err == nil {
+			return dirs[i], nil
+		}
+	}
+	return "", errors.New("initdb and pg_ctl not found; install PostgreSQL or set PG_BIN")
+}
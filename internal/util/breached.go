@@ -0,0 +1,49 @@
+package util
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// breachedPasswords is a bundled list of SHA-1 hashes of passwords known from public
+// breaches, in the same format as the Have I Been Pwned range API.
+//
+//go:embed breached_passwords.txt
+var breachedPasswords string
+
+var (
+	breachedOnce  sync.Once
+	breachedIndex map[string][]string
+)
+
+// loadBreachedIndex groups the bundled hashes by their 5-character prefix.
+func loadBreachedIndex() {
+	breachedIndex = make(map[string][]string)
+	scanner := bufio.NewScanner(strings.NewReader(breachedPasswords))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) != sha1.Size*2 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breachedIndex[line[:5]] = append(breachedIndex[line[:5]], line[5:])
+	}
+}
+
+// IsBreachedPassword reports whether password appears in the bundled breach list.
+// Like the k-anonymity range API, only the hash prefix selects a bucket and the
+// suffix is compared locally, so the password itself is never looked up.
+func IsBreachedPassword(password string) bool {
+	breachedOnce.Do(loadBreachedIndex)
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	for _, suffix := range breachedIndex[hash[:5]] {
+		if suffix == hash[5:] {
+			return true
+		}
+	}
+	return false
+}
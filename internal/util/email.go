@@ -1,24 +1,118 @@
 package util
 
 import (
-	"os"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/minab/internship-backend/internal/metrics"
+	"github.com/minab/internship-backend/internal/tracing"
 	"gopkg.in/mail.v2"
 )
 
-func SendEmail(to, subject, htmlBody string) error {
+// EmailSettings configures the mail server used by SendEmail and the frontend the
+// links in emails point to.
+type EmailSettings struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	// FrontendURL is the base URL of the links in emails.
+	FrontendURL string
+}
+
+var (
+	emailMu       sync.RWMutex
+	emailSettings = EmailSettings{Port: 587}
+)
+
+// ConfigureEmail sets the mail server and frontend URL used for emails.
+func ConfigureEmail(s EmailSettings) {
+	emailMu.Lock()
+	defer emailMu.Unlock()
+	emailSettings = s
+}
+
+func currentEmailSettings() EmailSettings {
+	emailMu.RLock()
+	defer emailMu.RUnlock()
+	return emailSettings
+}
+
+// FrontendLink returns the frontend URL of path, e.g. FrontendLink("/verify-email") for
+// a link in an email.
+func FrontendLink(path string) string {
+	return strings.TrimSuffix(currentEmailSettings().FrontendURL, "/") + path
+}
+
+// SendEmail sends an HTML email through the configured mail server, in a span of its own.
+func SendEmail(ctx context.Context, to, subject, htmlBody string) (err error) {
+	_, span := tracing.Start(ctx, "email.send")
+	defer tracing.End(span, &err)
+
+	settings := currentEmailSettings()
 	message := mail.NewMessage()
-	message.SetHeader("From", os.Getenv("EMAIL_FROM"))
+	message.SetHeader("From", settings.From)
 	message.SetHeader("To", to)
 	message.SetHeader("Subject", subject)
 	message.SetBody("text/html", htmlBody)
 
-	dialer := mail.NewDialer(
-		os.Getenv("EMAIL_HOST"),
-		587,
-		os.Getenv("EMAIL_USER"),
-		os.Getenv("EMAIL_PASS"),
-	)
+	dialer := mail.NewDialer(settings.Host, settings.Port, settings.Username, settings.Password)
+
+	err = dialer.DialAndSend(message)
+	if err != nil {
+		metrics.Emails.WithLabelValues("failed").Inc()
+		return err
+	}
+	metrics.Emails.WithLabelValues("sent").Inc()
+	return nil
+}
+
+// PingSMTP connects to the mail server and checks that it greets with a 220 reply,
+// without logging in or sending anything.
+func PingSMTP(ctx context.Context) error {
+	settings := currentEmailSettings()
+	if settings.Host == "" {
+		return errors.New("no mail server is configured")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(settings.Host, strconv.Itoa(settings.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "220") {
+		return fmt.Errorf("unexpected SMTP greeting %q", strings.TrimSpace(greeting))
+	}
+	fmt.Fprint(conn, "QUIT\r\n")
+	return nil
+}
 
-	return dialer.DialAndSend(message)
+// RenderEmailTemplate renders the HTML email template internal/templates/name with data.
+func RenderEmailTemplate(name string, data any) (string, error) {
+	tmpl, err := template.ParseFiles(filepath.Join("internal", "templates", name))
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
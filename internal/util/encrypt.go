@@ -1,13 +1,149 @@
 package util
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms. Hashes are self-describing (bcrypt's "$2a$"
+// prefix or the PHC "$argon2id$" string), so hashes of any algorithm and cost can be
+// verified while new ones use the configured algorithm.
+const (
+	HashAlgorithmBcrypt   = "bcrypt"
+	HashAlgorithmArgon2id = "argon2id"
+)
+
+// PasswordHashing configures how new password hashes are produced.
+type PasswordHashing struct {
+	Algorithm string
+	// BcryptCost is the bcrypt work factor.
+	BcryptCost int
+	// Argon2Memory is the Argon2id memory cost in KiB.
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	hashingMu sync.RWMutex
+	hashing   = PasswordHashing{
+		Algorithm:         HashAlgorithmArgon2id,
+		BcryptCost:        12,
+		Argon2Memory:      64 * 1024,
+		Argon2Iterations:  3,
+		Argon2Parallelism: 2,
+	}
+)
+
+// ConfigurePasswordHashing sets the algorithm and parameters used by HashPassword.
+// Existing hashes made with other settings keep verifying and are reported as outdated
+// by CheckPasswordHash.
+func ConfigurePasswordHashing(cfg PasswordHashing) error {
+	switch cfg.Algorithm {
+	case HashAlgorithmBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashAlgorithmArgon2id:
+		if cfg.Argon2Memory < 8*uint32(cfg.Argon2Parallelism) || cfg.Argon2Iterations < 1 || cfg.Argon2Parallelism < 1 {
+			return errors.New("argon2id needs iterations >= 1, parallelism >= 1 and memory >= 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+	hashingMu.Lock()
+	hashing = cfg
+	hashingMu.Unlock()
+	return nil
+}
+
+func currentHashing() PasswordHashing {
+	hashingMu.RLock()
+	defer hashingMu.RUnlock()
+	return hashing
+}
 
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	cfg := currentHashing()
+	if cfg.Algorithm == HashAlgorithmBcrypt {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
+		return string(bytes), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Iterations, cfg.Argon2Memory, cfg.Argon2Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPasswordHash reports whether password matches hash and, if it does, whether the
+// hash was made with an algorithm or parameters other than the configured ones and
+// should be replaced by a fresh HashPassword.
+func CheckPasswordHash(password, hash string) (ok bool, outdated bool) {
+	cfg := currentHashing()
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2Hash(hash)
+		if err != nil {
+			return false, false
+		}
+		got := argon2.IDKey([]byte(password), salt, params.Argon2Iterations, params.Argon2Memory, params.Argon2Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, false
+		}
+		outdated = cfg.Algorithm != HashAlgorithmArgon2id ||
+			params.Argon2Memory != cfg.Argon2Memory ||
+			params.Argon2Iterations != cfg.Argon2Iterations ||
+			params.Argon2Parallelism != cfg.Argon2Parallelism ||
+			len(key) != argon2KeyLength
+		return true, outdated
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cfg.Algorithm != HashAlgorithmBcrypt || cost != cfg.BcryptCost
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func decodeArgon2Hash(hash string) (PasswordHashing, []byte, []byte, error) {
+	var params PasswordHashing
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errors.New("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Iterations, &params.Argon2Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, err
+	}
+	params.Algorithm = HashAlgorithmArgon2id
+	return params, salt, key, nil
 }
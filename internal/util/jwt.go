@@ -2,39 +2,117 @@ package util
 
 import (
 	"errors"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtKey = []byte("398e001eabd08b2b140815171c2c72569eec9b076c501e73058ef6ea9b9b05e1")
+var (
+	jwtKeyMu sync.RWMutex
+	jwtKey   []byte
+)
+
+// ConfigureJWT sets the HMAC key that signs and verifies tokens. Tokens signed with a
+// previous key no longer verify.
+func ConfigureJWT(key []byte) {
+	jwtKeyMu.Lock()
+	defer jwtKeyMu.Unlock()
+	jwtKey = key
+}
+
+// currentJWTKey returns the configured key, failing when none is set so tokens are
+// never signed with an empty key.
+func currentJWTKey() ([]byte, error) {
+	jwtKeyMu.RLock()
+	defer jwtKeyMu.RUnlock()
+	if len(jwtKey) == 0 {
+		return nil, errors.New("no JWT key is configured")
+	}
+	return jwtKey, nil
+}
+
+// TokenLifetime is how long an issued JWT (and the session behind it) stays valid.
+const TokenLifetime = 24 * time.Hour
+
+// ImpersonationTokenLifetime is how long an admin may act as another user per token.
+const ImpersonationTokenLifetime = 15 * time.Minute
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// ImpersonatorID is the real admin behind an impersonation token; UserID is then
+	// the impersonated user and SessionID the admin's session.
+	ImpersonatorID string `json:"imp,omitempty"`
+	// APIKeyID and Scopes are set when the request was authenticated with an API key
+	// instead of a JWT; they are never part of an issued token.
+	APIKeyID string   `json:"-"`
+	Scopes   []string `json:"-"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(userID, email, role string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// IsAPIKey reports whether the claims come from an API key rather than a login session.
+func (c *Claims) IsAPIKey() bool {
+	return c.APIKeyID != ""
+}
+
+// IsImpersonated reports whether an admin is acting as this user.
+func (c *Claims) IsImpersonated() bool {
+	return c.ImpersonatorID != ""
+}
+
+// HasScope reports whether the caller may use scope. Login sessions carry every scope;
+// API keys only those they were created with.
+func (c *Claims) HasScope(scope string) bool {
+	return !c.IsAPIKey() || slices.Contains(c.Scopes, scope)
+}
+
+func GenerateJWT(userID, email, role, sessionID string) (string, error) {
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+	}
+	return signJWT(claims, TokenLifetime)
+}
+
+// GenerateImpersonationJWT issues a short-lived token that acts as the given user
+// while recording the admin behind it. It is bound to the admin's session, so logging
+// the admin out also ends the impersonation.
+func GenerateImpersonationJWT(userID, email, role, impersonatorID, impersonatorSessionID string) (string, time.Time, error) {
+	claims := &Claims{
+		UserID:         userID,
+		Email:          email,
+		Role:           role,
+		SessionID:      impersonatorSessionID,
+		ImpersonatorID: impersonatorID,
+	}
+	token, err := signJWT(claims, ImpersonationTokenLifetime)
+	return token, claims.ExpiresAt.Time, err
+}
+
+func signJWT(claims *Claims, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+	key, err := currentJWTKey()
+	if err != nil {
+		return "", err
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return token.SignedString(key)
 }
 
 func ParseJWT(tokenStr string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
+		return currentJWTKey()
 	})
 	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ErrPatchNotObject is returned when a merge patch is not a JSON object.
+var ErrPatchNotObject = errors.New("merge patch must be a JSON object")
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to the JSON document target and
+// returns the result. Members set to null in the patch are removed from the target;
+// objects are merged recursively and any other value replaces the target's.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var p map[string]any
+	if err := json.Unmarshal(patch, &p); err != nil || p == nil {
+		return nil, ErrPatchNotObject
+	}
+	var t any
+	if err := json.Unmarshal(target, &t); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(t, p))
+}
+
+func mergePatch(target any, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
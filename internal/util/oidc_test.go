@@ -0,0 +1,81 @@
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/minab/internship-backend/internal/oidctest"
+)
+
+func TestOIDCProviderExchange(t *testing.T) {
+	stub := oidctest.New(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		verifier string
+		nonce    string
+		wantErr  bool
+	}{
+		{
+			name:   "valid login",
+			claims: jwt.MapClaims{"email": "intern@example.com", "email_verified": true, "name": "Intern"},
+		},
+		{
+			name:     "wrong PKCE verifier",
+			verifier: "not-the-verifier-used-for-the-challenge-0123456789",
+			wantErr:  true,
+		},
+		{
+			name:    "nonce mismatch",
+			nonce:   "other-nonce",
+			wantErr: true,
+		},
+		{
+			name:    "token for another client",
+			claims:  jwt.MapClaims{"aud": "someone-else"},
+			wantErr: true,
+		},
+		{
+			name:    "expired token",
+			claims:  jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewOIDCProvider("stub", stub.URL, oidctest.ClientID, "secret", "http://localhost/callback", nil)
+			verifier := "verifier-0123456789-0123456789-0123456789-0123456789"
+			authURL, err := provider.AuthCodeURL(ctx, "state-"+tt.name, "nonce-1", verifier)
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+			code := stub.Authorize(t, authURL, tt.claims)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			nonce := "nonce-1"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			identity, err := provider.Exchange(ctx, code, verifier, nonce)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Exchange succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			want := OIDCIdentity{Subject: oidctest.Subject, Email: "intern@example.com", EmailVerified: true, Name: "Intern"}
+			if *identity != want {
+				t.Errorf("identity = %+v, want %+v", *identity, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response. Code is a stable, machine-readable
+// identifier of the error; Errors lists rejected fields of a validation error.
+type Problem struct {
+	Type      string             `json:"type"`
+	Title     string             `json:"title"`
+	Status    int                `json:"status"`
+	Detail    string             `json:"detail,omitempty"`
+	Instance  string             `json:"instance,omitempty"`
+	Code      string             `json:"code"`
+	RequestID string             `json:"request_id,omitempty"`
+	Errors    []model.FieldError `json:"errors,omitempty"`
+}
+
+// WriteProblem writes p as the response, filling in its type, title, instance and request ID.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if meta, ok := RequestMetaFromContext(r.Context()); ok {
+		p.RequestID = meta.RequestID
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// HTTPError is the problem details counterpart of http.Error.
+func HTTPError(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	WriteProblem(w, r, &Problem{Status: status, Code: code, Detail: detail})
+}
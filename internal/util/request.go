@@ -0,0 +1,147 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+var (
+	proxiesMu      sync.RWMutex
+	trustedProxies []netip.Prefix
+)
+
+// ConfigureTrustedProxies sets the reverse proxies whose forwarding headers ClientIP
+// believes, as CIDR ranges or single addresses such as 10.0.0.0/8 or 127.0.0.1.
+func ConfigureTrustedProxies(proxies []string) error {
+	prefixes, err := ParseTrustedProxies(proxies)
+	if err != nil {
+		return err
+	}
+	proxiesMu.Lock()
+	defer proxiesMu.Unlock()
+	trustedProxies = prefixes
+	return nil
+}
+
+// ParseTrustedProxies parses CIDR ranges and single addresses into prefixes.
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if addr, err := netip.ParseAddr(p); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR range", p)
+		}
+		if prefix.Addr().Is4In6() {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func isTrustedProxy(addr netip.Addr) bool {
+	proxiesMu.RLock()
+	defer proxiesMu.RUnlock()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent the request. Forwarding headers
+// are only believed from trusted proxies: when the socket address is one, the
+// right-most X-Forwarded-For hop that is not a trusted proxy is the client, or else
+// X-Real-IP. Hops that are not IP addresses end the search, so the result is always a
+// valid address of at most 45 characters unless the socket address itself is not one.
+func ClientIP(r *http.Request) string {
+	remote, ok := parseIP(r.RemoteAddr)
+	if !ok {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+	if !isTrustedProxy(remote) {
+		return remote.String()
+	}
+
+	client := remote
+	if hops := forwardedHops(r); len(hops) > 0 {
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, ok := parseIP(hops[i])
+			if !ok {
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop) {
+				break
+			}
+		}
+		return client.String()
+	}
+	if realIP, ok := parseIP(r.Header.Get("X-Real-IP")); ok {
+		return realIP.String()
+	}
+	return client.String()
+}
+
+// forwardedHops returns the addresses of every X-Forwarded-For header, in order.
+func forwardedHops(r *http.Request) []string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseIP parses an address with or without a port, dropping any IPv6 zone and
+// unmapping IPv4-mapped IPv6 addresses.
+func parseIP(s string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().WithZone("").Unmap(), true
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// RequestMeta describes the HTTP request a piece of work is done for.
+type RequestMeta struct {
+	RequestID string
+	IPAddress string
+	UserAgent string
+	// UserID is set once the request is authenticated, for logging.
+	UserID string
+	// Route is the path pattern of the matched route, e.g. /api/v1/users/{id}, set by the
+	// router for metrics. It is empty if no route matched.
+	Route string
+}
+
+const requestMetaKey = contextKey("requestMeta")
+
+func ContextWithRequestMeta(ctx context.Context, meta *RequestMeta) context.Context {
+	return context.WithValue(ctx, requestMetaKey, meta)
+}
+
+func RequestMetaFromContext(ctx context.Context) (*RequestMeta, bool) {
+	meta, ok := ctx.Value(requestMetaKey).(*RequestMeta)
+	return meta, ok
+}
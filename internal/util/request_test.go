@@ -0,0 +1,62 @@
+package util
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := ConfigureTrustedProxies([]string{"10.0.0.0/8", "::ffff:192.168.1.1"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ConfigureTrustedProxies(nil) })
+
+	long := strings.Repeat("1", 100)
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4000", nil, "", "203.0.113.7"},
+		{"spoofed X-Forwarded-For", "203.0.113.7:4000", []string{"198.51.100.1"}, "", "203.0.113.7"},
+		{"spoofed X-Real-IP", "203.0.113.7:4000", nil, "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"client prepends a fake hop", "10.0.0.2:4000", []string{"192.0.2.66, 198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:4000", []string{"198.51.100.1, 10.0.0.9", "10.1.2.3"}, "", "198.51.100.1"},
+		{"only trusted hops", "10.0.0.2:4000", []string{"10.0.0.9"}, "", "10.0.0.9"},
+		{"mapped trusted proxy", "192.168.1.1:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"X-Real-IP from a trusted proxy", "10.0.0.2:4000", nil, "198.51.100.1", "198.51.100.1"},
+		{"oversized hop", "10.0.0.2:4000", []string{long}, "", "10.0.0.2"},
+		{"invalid nearest hop", "10.0.0.2:4000", []string{"198.51.100.1, not-an-ip"}, "", "10.0.0.2"},
+		{"oversized X-Real-IP", "10.0.0.2:4000", nil, long, "10.0.0.2"},
+		{"IPv6 with zone", "[fe80::1%eth0]:4000", nil, "", "fe80::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, f := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", f)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			got := ClientIP(r)
+			if got != tt.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tt.want)
+			}
+			if len(got) > 45 {
+				t.Fatalf("ClientIP returned %d characters, more than the ip_address columns hold", len(got))
+			}
+		})
+	}
+}
+
+func TestConfigureTrustedProxiesRejectsInvalid(t *testing.T) {
+	if err := ConfigureTrustedProxies([]string{"10.0.0.0/8", "proxy.internal"}); err == nil {
+		t.Fatal("accepted a host name as a trusted proxy")
+	}
+}
@@ -0,0 +1,112 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/minab/internship-backend/internal/model"
+)
+
+// e164Pattern matches phone numbers in E.164 format, e.g. +251911234567.
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+func validatorInstance() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+		// Report fields by their JSON names.
+		validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		validate.RegisterValidation("phone", func(fl validator.FieldLevel) bool {
+			return e164Pattern.MatchString(fl.Field().String())
+		})
+		validate.RegisterValidation("role", func(fl validator.FieldLevel) bool {
+			return model.IsValidRole(fl.Field().String())
+		})
+		validate.RegisterValidation("scope", func(fl validator.FieldLevel) bool {
+			return model.IsValidScope(fl.Field().String())
+		})
+	})
+	return validate
+}
+
+// ValidateStruct evaluates the validate tags of v and returns one FieldError per
+// failed rule, named after the JSON field. It returns nil if v is valid.
+func ValidateStruct(v any) []model.FieldError {
+	err := validatorInstance().Struct(v)
+	if err == nil {
+		return nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []model.FieldError{{Code: "invalid", Message: err.Error()}}
+	}
+	fields := make([]model.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, model.FieldError{
+			Field:   fieldPath(fe),
+			Code:    fe.Tag(),
+			Message: validationMessage(fe),
+		})
+	}
+	return fields
+}
+
+// fieldPath returns the JSON path of the field without the top-level struct name,
+// e.g. "scopes[1]".
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		return "must be an E.164 phone number such as +251911234567"
+	case "role":
+		return "must be one of " + strings.Join(model.Roles, ", ")
+	case "scope":
+		return "must be one of " + strings.Join(model.APIKeyScopes, ", ")
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at least %s items", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must contain at most %s items", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	default:
+		return "failed the " + fe.Tag() + " rule"
+	}
+}
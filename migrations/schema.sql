@@ -1,4 +1,6 @@
 -- Drop tables in correct order
+DROP TABLE IF EXISTS schema_migrations CASCADE;
+DROP TABLE IF EXISTS idempotency_keys CASCADE;
 DROP TABLE IF EXISTS comments CASCADE;
 DROP TABLE IF EXISTS submissions CASCADE;
 DROP TABLE IF EXISTS progress CASCADE;
@@ -10,6 +12,13 @@ DROP TABLE IF EXISTS reading_task_templates CASCADE;
 DROP TABLE IF EXISTS internship_requests CASCADE;
 DROP TABLE IF EXISTS appointments CASCADE;
 DROP TABLE IF EXISTS assignments CASCADE;
+DROP TABLE IF EXISTS email_verification_tokens CASCADE;
+DROP TABLE IF EXISTS audit_events CASCADE;
+DROP TABLE IF EXISTS password_history CASCADE;
+DROP TABLE IF EXISTS oidc_login_states CASCADE;
+DROP TABLE IF EXISTS user_identities CASCADE;
+DROP TABLE IF EXISTS api_keys CASCADE;
+DROP TABLE IF EXISTS user_sessions CASCADE;
 DROP TABLE IF EXISTS password_reset_tokens CASCADE;
 DROP TABLE IF EXISTS users CASCADE;
 
@@ -23,12 +32,15 @@ CREATE TABLE users (
     email VARCHAR(100) UNIQUE NOT NULL,
     password TEXT NOT NULL,
     phone_number VARCHAR(20) NOT NULL DEFAULT '',
-    status VARCHAR(20) NOT NULL DEFAULT 'applicant',
+    role VARCHAR(20) NOT NULL DEFAULT 'applicant',
+    is_service_account BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- Incremented by every update; exposed as the ETag for optimistic concurrency
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP,
-    CONSTRAINT chk_status CHECK (status IN ('applicant', 'mentor', 'admin')),
-    CONSTRAINT chk_phone_format CHECK (phone_number ~ '^\+?[0-9]{7,15}$')
+    CONSTRAINT chk_role CHECK (role IN ('applicant', 'mentor', 'admin')),
+    CONSTRAINT chk_phone_format CHECK (phone_number = '' OR phone_number ~ '^\+?[0-9]{7,15}$')
 );
 
 
@@ -65,6 +77,7 @@ CREATE TABLE reading_tasks (
     deadline TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 
@@ -78,6 +91,7 @@ CREATE TABLE progress (
     completed_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 
@@ -104,6 +118,7 @@ CREATE TABLE projects (
     review_status VARCHAR(20) DEFAULT 'not_scheduled',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP,
     CONSTRAINT chk_review_status CHECK (review_status IN ('not_scheduled', 'scheduled', 'reviewed'))
 );
@@ -118,6 +133,7 @@ CREATE TABLE project_tasks (
     status VARCHAR(20) DEFAULT 'pending',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 
@@ -132,6 +148,7 @@ CREATE TABLE submissions (
     feedback TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 
@@ -143,7 +160,8 @@ CREATE TABLE comments (
     submission_id UUID REFERENCES submissions(id),
     comment TEXT NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1
 );
 
 -- Assignments (misc tasks)
@@ -156,6 +174,7 @@ CREATE TABLE assignments (
     submitted_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 
@@ -169,16 +188,133 @@ CREATE TABLE appointments (
     status VARCHAR(20) DEFAULT 'scheduled',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
     deleted_at TIMESTAMP
 );
 
 -- Password Reset Tokens
 CREATE TABLE password_reset_tokens (
-    token TEXT PRIMARY KEY,
-    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) PRIMARY KEY, -- SHA-256 of the token; the token itself is only emailed
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- User Sessions (one per login, referenced by the JWT "sid" claim)
+CREATE TABLE user_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+-- API Keys (only the SHA-256 hash of the secret is stored)
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+-- External identities (OpenID Connect subject per provider)
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_user_identities_provider_subject UNIQUE (provider, subject)
+);
+
+-- Pending OIDC logins (state, nonce and PKCE verifier between redirect and callback)
+CREATE TABLE oidc_login_states (
+    state TEXT PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    code_verifier TEXT NOT NULL,
+    nonce TEXT NOT NULL,
     expires_at TIMESTAMP NOT NULL
 );
 
+-- Password History (hashes of recent passwords, to prevent reuse)
+CREATE TABLE password_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit Events (append-only; user IDs are not foreign keys so entries survive user deletion)
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id TEXT NOT NULL DEFAULT '',
+    impersonator_id TEXT NOT NULL DEFAULT '',
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    changes JSONB NOT NULL DEFAULT '{}',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Each event stores the hash of the one before it, so edits and deletions are detectable
+    prev_hash TEXT NOT NULL DEFAULT '',
+    hash CHAR(64) NOT NULL
+);
+
+-- The audit log is append-only
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- Pending email changes, applied once the new address is confirmed
+CREATE TABLE email_verification_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- First responses to POST requests sent with an Idempotency-Key, replayed on retries
+CREATE TABLE idempotency_keys (
+    scope TEXT NOT NULL, -- User ID, or 'anonymous' for unauthenticated requests
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER, -- NULL while the first request is in progress
+    response_headers JSONB,
+    response_body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+-- Applied schema version, checked by /readyz against repository.SchemaVersion
+CREATE TABLE schema_migrations (
+    version INTEGER PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Indexes
 CREATE INDEX idx_users_email ON users(email);
 CREATE INDEX idx_reading_tasks_assigned_to ON reading_tasks(assigned_to);
@@ -190,3 +326,18 @@ CREATE INDEX idx_assignments_user_id ON assignments(user_id);
 CREATE INDEX idx_appointments_user_id ON appointments(user_id);
 CREATE INDEX idx_comments_project_task_id ON comments(project_task_id);
 CREATE INDEX idx_comments_submission_id ON comments(submission_id);
+CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+CREATE INDEX idx_password_history_user_id ON password_history(user_id);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_impersonator_id ON audit_events(impersonator_id);
+CREATE INDEX idx_audit_events_target ON audit_events(target_type, target_id);
+CREATE INDEX idx_audit_events_request_id ON audit_events(request_id);
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX idx_password_reset_tokens_user_id ON password_reset_tokens(user_id);
+CREATE INDEX idx_email_verification_tokens_user_id ON email_verification_tokens(user_id);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- Bump together with repository.SchemaVersion on every schema change
+INSERT INTO schema_migrations (version) VALUES (3);